@@ -5,9 +5,12 @@ go 1.13
 require (
 	github.com/EDDYCJY/fake-useragent v0.2.0
 	github.com/PuerkitoBio/goquery v1.5.1
-	github.com/andybalholm/cascadia v1.2.0 // indirect
+	github.com/andybalholm/cascadia v1.2.0
+	github.com/dop251/goja v0.0.0-20211022113120-dc8c55024d06
 	github.com/fatih/color v1.9.0
 	github.com/mattn/go-colorable v0.1.6 // indirect
-	golang.org/x/net v0.0.0-20200602114024-627f9648deb9 // indirect
+	github.com/miekg/dns v1.1.30
+	golang.org/x/net v0.0.0-20200602114024-627f9648deb9
 	golang.org/x/sys v0.0.0-20200610111108-226ff32320da // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
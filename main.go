@@ -1,11 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ameenmaali/whoareyou/pkg/config"
 	"github.com/ameenmaali/whoareyou/pkg/matcher"
@@ -13,13 +16,25 @@ import (
 )
 
 type Task struct {
-	Url string
+	Url    string
+	Target utils.Target
+	// Number of links followed from a URL provided to get to this one, when crawling
+	Depth int
 }
 
 var conf config.Config
 var opts config.CliOptions
 var failedRequestsSent int
 var successfulRequestsSent int
+var hostResults = matcher.NewHostResults()
+var outputMutex sync.Mutex
+var scheduler *utils.Scheduler
+var crawler *utils.Crawler
+var resourceCache *utils.ResourceCache
+var dnsResolver *utils.DnsResolver
+var siteFileCache *utils.SiteFileCache
+var probeCache *utils.ProbeCache
+var errorProbes []matcher.Probe
 
 func main() {
 	// Create an empty conf object
@@ -33,94 +48,388 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Get the URLs provided, deduplicate, and load properly formatted ones into slice
-	urls, err := utils.GetUrlsFromFile(&conf)
-	if err != nil {
-		fmt.Println("Error getting URLs from stdin: ", err)
-	}
-
 	// Create HTTP Transport and Client after parsing flags
-	conf.HttpClient = utils.CreateClient(opts.Timeout)
+	conf.HttpClient = utils.CreateClient(opts.Timeout, &conf)
 
 	// Fetch the latest wappalyzer data
-	conf.TechInScope, err = utils.FetchWappalyzerData(&conf)
-	if err != nil {
-		fmt.Println("Error fetching data from Wappalyzer: ", err)
+	if !opts.DisableWappalyzer {
+		conf.TechInScope, err = utils.FetchWappalyzerData(&conf)
+		if err != nil {
+			fmt.Println("Error fetching data from Wappalyzer: ", err)
+		}
 	}
 
 	// Check if specific technology to lookup, else include all
 	conf.UpdateTechnologyInScope()
 
-	tasks := make(chan Task)
+	// Only the globals checked by a JavaScript rule are read once a page's scripts have run
+	if opts.DisableWappalyzer {
+		conf.JavaScriptGlobals = matcher.JavaScriptGlobals(conf.CustomMatch)
+	} else {
+		conf.JavaScriptGlobals = matcher.JavaScriptGlobals(conf.TechInScope, conf.CustomMatch)
+	}
+
+	// Stream the URLs and hosts provided, deduplicated and properly formatted, as they are read
+	targets := make(chan utils.Target)
+	go func() {
+		if err := utils.StreamTargets(&conf, targets); err != nil {
+			fmt.Println("Error getting URLs from stdin: ", err)
+		}
+	}()
+
+	// Interleave hosts when handing out tasks, so no single host gets every worker
+	scheduler = utils.NewScheduler(conf.Rate, conf.HostRate, conf.HostConcurrency)
+	// Every request (retries, redirects, resources and probes included) is sent within the scheduler's limits
+	conf.HttpClient.Transport = utils.LimitTransport(conf.HttpClient.Transport, scheduler)
+	crawler = utils.NewCrawler(conf.MaxPages)
+	resourceCache = utils.NewResourceCache(conf.ResourceCacheSize)
+	siteFileCache = utils.NewSiteFileCache()
+	probeCache = utils.NewProbeCache()
+	errorProbes = utils.NewErrorProbes()
+	dnsResolver = utils.NewDnsResolver(conf.Resolver, time.Duration(opts.Timeout)*time.Second)
 	var wg sync.WaitGroup
 
 	for i := 0; i < opts.Concurrency; i++ {
 		wg.Add(1)
 		go func() {
-			for task := range tasks {
-				task.execute()
+			for {
+				host, task, ok := scheduler.Next()
+				if !ok {
+					break
+				}
+				task.(Task).execute()
+				// Probe responses, site files and DNS records are only kept while a host has tasks queued or running
+				if scheduler.Done(host) {
+					probeCache.Forget(host)
+					siteFileCache.Forget(host)
+					dnsResolver.Forget(host)
+				}
 			}
 			wg.Done()
 		}()
 	}
 
-	for _, u := range urls {
-		tasks <- Task{Url: u}
+	for target := range targets {
+		scheduler.Add(utils.HostName(target.Candidates[0]), Task{Target: target})
 	}
 
-	close(tasks)
+	scheduler.Close()
 	wg.Wait()
+
+	if conf.HostReport {
+		printHostResults()
+	}
 }
 
-func (t Task) execute() {
-	resp, err := utils.SendRequest(t.Url, &conf)
+func printHostResults() {
+	for _, result := range hostResults.Results() {
+		if conf.JsonOutput {
+			printJson(result)
+			continue
+		}
+
+		if len(result.TechFound) == 0 {
+			if conf.DebugMode {
+				conf.Utils.PrintYellow(os.Stderr, "[%v]: no matches found\n", result.Host)
+			}
+			continue
+		}
+
+		var techWithEvidence []string
+		for _, tech := range result.TechFound {
+			techWithEvidence = append(techWithEvidence, fmt.Sprintf("%v (%v)", tech, strings.Join(result.Evidence[tech], ", ")))
+		}
+		conf.Utils.PrintGreen(os.Stdout, "[%v]: [%v]\n", result.Host, strings.Join(techWithEvidence, ", "))
+	}
+}
+
+func printJson(result interface{}) {
+	data, err := json.Marshal(result)
 	if err != nil {
+		conf.Utils.PrintRed(os.Stderr, "error encoding result as JSON: %v\n", err)
+		return
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Println(string(data))
+}
+
+func (t Task) execute() {
+	matchResult := matcher.MatchResult{
+		Url:               t.Target.Candidates[0],
+		Input:             t.Target.Input,
+		TechnologyMatches: map[string][]string{},
+		TechFound:         []string{},
+		Metadata:          t.Target.Metadata,
+	}
+
+	// DNS records are looked up once per host, and evaluated with every response from it
+	if conf.LookupDns {
+		matchResult.Dns = dnsResolver.Lookup(utils.HostName(matchResult.Url), &conf)
+	}
+
+	// Only URL (and DNS) rules can be checked without sending a request, so classify the first candidate URL as is
+	if conf.NoFetch {
+		evaluate(&matcher.ResponseData{RequestUrl: matchResult.Url, Dns: matchResult.Dns}, &matchResult)
+		t.report(matchResult)
+		return
+	}
+
+	// Try each candidate URL in order, and scan the first one that answers
+	var resp utils.Response
+	var attempts int
+	var err error
+	for _, candidate := range t.Target.Candidates {
+		t.Url = candidate
+		resp, attempts, err = utils.SendRequestWithRetries(t.Url, &conf, scheduler)
+		if err == nil {
+			break
+		}
+
 		failedRequestsSent += 1
 		if conf.DebugMode {
 			conf.Utils.PrintRed(os.Stderr, "error sending HTTP request to %v: %v\n", t.Url, err)
 		}
+	}
+	if err != nil {
+		// Hosts without a web server can still be identified by their DNS records
+		if len(matchResult.Dns) > 0 {
+			evaluate(&matcher.ResponseData{Dns: matchResult.Dns}, &matchResult)
+			t.report(matchResult)
+		}
 		return
 	}
 	successfulRequestsSent += 1
 
-	responseBody := string(resp.Body)
-	if responseBody == "" {
+	if conf.CrawlDepth > 0 {
+		crawler.MarkVisited(t.Url)
+		crawler.MarkVisited(resp.FinalUrl)
+	}
+
+	if conf.DebugMode && t.Url != t.Target.Input {
+		conf.Utils.PrintCyan(os.Stderr, "[%v]: answered on %v\n", t.Target.Input, t.Url)
+	}
+
+	matchResult.Url = t.Url
+	matchResult.Attempts = attempts
+	matchResult.FinalUrl = resp.FinalUrl
+	matchResult.Redirects = resp.Redirects
+	matchResult.Certificate = resp.Certificate
+	if conf.FetchSiteFiles {
+		matchResult.SiteFiles = siteFileCache.Get(t.host(), resp.FinalUrl, &conf)
+	}
+
+	htmlExtractions := evaluateResponse(t.Url, resp, &matchResult)
+
+	// Follow meta refresh and JavaScript redirects, analyzing each destination as part of the same target
+	visited := map[string]bool{t.Url: true, resp.FinalUrl: true}
+	for i := 0; conf.FollowClientRedirects && i < conf.MaxClientRedirects; i++ {
+		destination := utils.ResolveUrl(resp.FinalUrl, htmlExtractions.ClientRedirect)
+		if destination == "" || visited[destination] {
+			break
+		}
+		visited[destination] = true
+
+		// Client side redirects follow the same policy as HTTP redirects
+		from, _ := url.Parse(t.Url)
+		to, parseErr := url.Parse(destination)
+		if parseErr != nil || from == nil || !utils.RedirectAllowed(from, to, &conf) {
+			if conf.DebugMode {
+				conf.Utils.PrintYellow(os.Stderr, "not following client side redirect from %v to %v\n", t.Url, destination)
+			}
+			break
+		}
+
+		resp, _, err = utils.SendRequestWithRetries(destination, &conf, scheduler)
+		if err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error following client side redirect from %v to %v: %v\n", t.Url, destination, err)
+			}
+			break
+		}
+		visited[resp.FinalUrl] = true
+
+		matchResult.ClientRedirects = append(matchResult.ClientRedirects, destination)
+		htmlExtractions = evaluateResponse(destination, resp, &matchResult)
+	}
+
+	runProbes(t.host(), resp.FinalUrl, &matchResult)
+	if conf.ErrorPages {
+		runErrorProbes(t.host(), resp.FinalUrl, &matchResult)
+	}
+
+	// Queue same origin pages linked from this one, which are scanned by the same workers
+	if t.Depth < conf.CrawlDepth {
+		t.crawl(resp.FinalUrl, htmlExtractions)
+	}
+
+	t.report(matchResult)
+}
+
+// host returns the host name the task was scheduled for
+func (t Task) host() string {
+	return utils.HostName(t.Target.Candidates[0])
+}
+
+// report prints the result for a URL, or adds it to the results of its host when reporting per host
+func (t Task) report(matchResult matcher.MatchResult) {
+	// Rule files can override the metadata of Wappalyzer technologies they redefine
+	if !opts.DisableWappalyzer {
+		matchResult.AddInfo(conf.TechInScope)
+	}
+	matchResult.AddInfo(conf.CustomMatch)
+
+	// Host level results are printed once all URLs are scanned
+	if conf.HostReport {
+		hostResults.Add(utils.HostKeyFromString(matchResult.Url), &matchResult)
+		return
+	}
+
+	if conf.JsonOutput {
+		printJson(matchResult)
 		return
 	}
 
-	// Extract relevant data from HTML docs
+	if len(matchResult.TechFound) > 0 {
+		conf.Utils.PrintGreen(os.Stdout, "[%v]: [%v]\n", matchResult.Url, strings.Join(matchResult.TechFound, ", "))
+	} else {
+		if conf.DebugMode {
+			conf.Utils.PrintYellow(os.Stderr, "[%v]: no matches found\n", matchResult.Url)
+		}
+	}
+}
+
+func (t Task) crawl(pageUrl string, htmlExtractions matcher.HtmlExtractions) {
+	origin := utils.HostKeyFromString(pageUrl)
+	links := append(htmlExtractions.Links, htmlExtractions.ScriptTags...)
+
+	for _, link := range links {
+		page := utils.ResolveUrl(pageUrl, link)
+		if page == "" || utils.HostKeyFromString(page) != origin || !crawler.Visit(page) {
+			continue
+		}
+
+		scheduler.Push(utils.HostName(page), Task{
+			Target: utils.Target{
+				Input:      t.Target.Input,
+				Candidates: []string{page},
+				Metadata:   t.Target.Metadata,
+			},
+			Depth: t.Depth + 1,
+		})
+	}
+}
+
+// evaluateResponse matches a response against every technology in scope, adding matches to the result, and returns the
+// data extracted from its HTML
+func evaluateResponse(requestUrl string, resp utils.Response, matchResult *matcher.MatchResult) matcher.HtmlExtractions {
+	responseBody := string(resp.Body)
+
+	// Extract relevant data from HTML docs. Responses without a body (i.e. redirects) are still matched on headers
 	htmlExtractions := matcher.HtmlExtractions{
 		ScriptTags:       []string{},
 		InlineJavaScript: []string{},
 		MetaTags:         map[string]string{},
 	}
-	htmlExtractions.Parse(resp.GoQueryDoc)
+	if resp.GoQueryDoc != nil {
+		htmlExtractions.Parse(resp.GoQueryDoc)
+	}
 	htmlExtractions.RawHtmlBody = &responseBody
 
-	techMatches := map[string][]string{}
-	matchResult := matcher.MatchResult{
-		Url:               t.Url,
-		TechnologyMatches: techMatches,
-		TechFound:         []string{},
+	responseData := matcher.ResponseData{
+		HtmlExtractions: htmlExtractions,
+		Document:        resp.GoQueryDoc,
+		RequestUrl:      requestUrl,
+		Certificate:     resp.Certificate,
+		Dns:             matchResult.Dns,
+		SiteFiles:       matchResult.SiteFiles,
+		Responses: append(resp.Redirects, matcher.RedirectHop{
+			Url:        resp.FinalUrl,
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Headers,
+		}),
+	}
+
+	if conf.FetchScripts {
+		responseData.Scripts = utils.FetchScripts(resp.FinalUrl, htmlExtractions.ScriptTags, &conf, resourceCache)
+	}
+
+	responseData.Css = htmlExtractions.InlineCss
+	if conf.FetchCss {
+		responseData.Css = append(responseData.Css, utils.FetchStylesheets(resp.FinalUrl, htmlExtractions.Stylesheets, &conf, resourceCache)...)
 	}
 
+	if conf.FetchFavicons {
+		responseData.Favicons = utils.FetchFavicons(resp.FinalUrl, htmlExtractions.Icons, &conf, resourceCache)
+		matchResult.Favicons = matcher.MergeFavicons(matchResult.Favicons, responseData.Favicons)
+	}
+
+	// Scripts run in the order a browser would mostly see them, libraries loaded from external scripts first
+	if conf.EvaluateJavaScript {
+		scripts := append(append([]string{}, responseData.Scripts...), htmlExtractions.InlineJavaScript...)
+		responseData.JavaScriptGlobals = matcher.EvaluateJavaScript(resp.FinalUrl, scripts, conf.JavaScriptGlobals, conf.JavaScriptTimeout)
+	}
+
+	evaluate(&responseData, matchResult)
+	return htmlExtractions
+}
+
+// runProbes sends the probes of technologies to the host of a page, and adds matches for those whose responses match.
+// Unless active probing is enabled, only the probes of technologies already found passively are sent, to confirm them
+func runProbes(owner string, pageUrl string, matchResult *matcher.MatchResult) {
+	send := func(probe *matcher.Probe) *matcher.ProbeResponse {
+		return probeCache.Get(owner, pageUrl, probe, &conf)
+	}
+
+	for key, value := range conf.CustomMatch {
+		if len(value.Matches.Probes) == 0 {
+			continue
+		}
+		if _, found := matchResult.TechnologyMatches[key]; !found && !conf.ActiveProbes {
+			continue
+		}
+		value.Matches.EvaluateProbes(key, send, matchResult)
+	}
+}
+
+// runErrorProbes requests error pages from the host of a page, and matches them against the built in error page rules
+// of technologies in scope and the error page rules of custom matches
+func runErrorProbes(owner string, pageUrl string, matchResult *matcher.MatchResult) {
+	var responses []*matcher.ProbeResponse
+	for i := range errorProbes {
+		if resp := probeCache.Get(owner, pageUrl, &errorProbes[i], &conf); resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+
+	// The built in rules are named as Wappalyzer technologies are, so they follow the same scope
 	if !opts.DisableWappalyzer {
-		for key, value := range conf.TechInScope {
-			value.Matches.HtmlExtractions = htmlExtractions
-			value.Matches.Evaluate(key, &matchResult)
+		for key, value := range matcher.ErrorPageRules {
+			if _, inScope := conf.TechInScope[key]; inScope {
+				value.Matches.EvaluateErrorPages(key, responses, matchResult)
+			}
 		}
 	}
 
 	for key, value := range conf.CustomMatch {
-		value.Matches.HtmlExtractions = htmlExtractions
-		value.Matches.Evaluate(key, &matchResult)
+		value.Matches.EvaluateErrorPages(key, responses, matchResult)
 	}
+}
 
-	if len(matchResult.TechFound) > 0 {
-		conf.Utils.PrintGreen(os.Stdout, "[%v]: [%v]\n", matchResult.Url, strings.Join(matchResult.TechFound, ", "))
-	} else {
-		if conf.DebugMode {
-			conf.Utils.PrintYellow(os.Stderr, "[%v]: no matches found\n", matchResult.Url)
+// evaluate matches response data against every technology in scope, adding matches to the result
+func evaluate(responseData *matcher.ResponseData, matchResult *matcher.MatchResult) {
+	if !opts.DisableWappalyzer {
+		for key, value := range conf.TechInScope {
+			value.Matches.Evaluate(key, responseData, matchResult)
 		}
 	}
+
+	for key, value := range conf.CustomMatch {
+		value.Matches.Evaluate(key, responseData, matchResult)
+	}
+
+	for key, value := range conf.FaviconDatabase {
+		value.Matches.Evaluate(key, responseData, matchResult)
+	}
 }
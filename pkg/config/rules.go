@@ -0,0 +1,222 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
+)
+
+// Extensions of the rule files loaded from a rules directory
+var ruleFileExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// Syntax errors are reported as "yaml: line 3: ...", and reformatted as other rule file errors are
+var syntaxErrorLine = regexp.MustCompile(`^yaml: (?:line (\d+): )?`)
+
+// ruleError is an error in a rule file, reported with the file name and line number it was found at
+func ruleError(path string, node *yaml.Node, format string, args ...interface{}) error {
+	return errors.New(fmt.Sprintf("%v:%v: %v", path, node.Line, fmt.Sprintf(format, args...)))
+}
+
+// syntaxError reports a syntax error in a rule file with the line number it was found at, when the decoder gives one
+func syntaxError(path string, err error) error {
+	match := syntaxErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return errors.New(fmt.Sprintf("%v: %v", path, err))
+	}
+
+	message := strings.TrimPrefix(err.Error(), match[0])
+	if match[1] == "" {
+		return errors.New(fmt.Sprintf("%v: %v", path, message))
+	}
+	return errors.New(fmt.Sprintf("%v:%v: %v", path, match[1], message))
+}
+
+// parseRuleDirectory returns the rule files (YAML or JSON) in a directory, sorted by name
+func parseRuleDirectory(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, file := range files {
+		if !file.IsDir() && ruleFileExtensions[strings.ToLower(filepath.Ext(file.Name()))] {
+			paths = append(paths, filepath.Join(dir, file.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// parseRuleFiles loads the rules in each file. Rules are named as Wappalyzer technologies are, so their matches merge
+// with any found by Wappalyzer for the same technology
+func (c *Config) parseRuleFiles(paths []string) error {
+	found := map[string]string{}
+	for _, path := range paths {
+		rules, err := parseRuleFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range rules {
+			key := strings.ToLower(rule.app.Name)
+			if previous, ok := found[key]; ok {
+				return ruleError(path, rule.node, "rule %v is already defined at %v", rule.app.Name, previous)
+			}
+			found[key] = fmt.Sprintf("%v:%v", path, rule.node.Line)
+			c.CustomMatch[key] = rule.app
+		}
+	}
+	return nil
+}
+
+type rule struct {
+	app  matcher.AppMatch
+	node *yaml.Node
+}
+
+// parseRuleFile reads a YAML (or JSON) file of rules. Each document is a list of rules, an object with a list of rules
+// under "rules", or a single rule
+func parseRuleFile(path string) ([]rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []rule
+	decoder := yaml.NewDecoder(file)
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, syntaxError(path, err)
+		}
+		if len(document.Content) == 0 {
+			continue
+		}
+
+		node := document.Content[0]
+		if node.Kind == yaml.MappingNode {
+			if list := mappingValue(node, "rules"); list != nil {
+				node = list
+			}
+		}
+
+		var ruleNodes []*yaml.Node
+		switch node.Kind {
+		case yaml.SequenceNode:
+			ruleNodes = node.Content
+		case yaml.MappingNode:
+			ruleNodes = []*yaml.Node{node}
+		default:
+			return nil, ruleError(path, node, "rule files must contain a rule, or a list of rules")
+		}
+
+		for _, ruleNode := range ruleNodes {
+			app, err := parseRule(path, ruleNode)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule{app: app, node: ruleNode})
+		}
+	}
+	return rules, nil
+}
+
+// parseRule parses a rule's metadata (name, description, categories, website and tags) and its match sources, which
+// are the match types of the -m flag
+func parseRule(path string, node *yaml.Node) (matcher.AppMatch, error) {
+	match := matcher.Matcher{}
+	app := matcher.AppMatch{Matches: &match}
+	if node.Kind != yaml.MappingNode {
+		return app, ruleError(path, node, "a rule must be an object")
+	}
+
+	seen := map[string]bool{}
+	sources := 0
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		key := keyNode.Value
+		if seen[strings.ToLower(key)] {
+			return app, ruleError(path, keyNode, "%v is defined more than once", key)
+		}
+		seen[strings.ToLower(key)] = true
+
+		var err error
+		switch key {
+		case "name":
+			app.Name, err = scalarValue(valueNode)
+		case "description":
+			app.Description, err = scalarValue(valueNode)
+		case "website":
+			app.Website, err = scalarValue(valueNode)
+		case "categories":
+			app.Categories, err = stringListValue(valueNode)
+		case "tags":
+			app.Tags, err = stringListValue(valueNode)
+		default:
+			var value interface{}
+			if err = valueNode.Decode(&value); err == nil {
+				err = parseMatchSource(&match, key, value)
+			}
+			sources++
+		}
+		if err != nil {
+			return app, ruleError(path, keyNode, "%v: %v", key, err)
+		}
+	}
+
+	if strings.TrimSpace(app.Name) == "" {
+		return app, ruleError(path, node, "rule has no name")
+	}
+	if sources == 0 {
+		return app, ruleError(path, node, "rule %v has no match sources", app.Name)
+	}
+	return app, nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarValue(node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", errors.New("must be a string")
+	}
+	return node.Value, nil
+}
+
+func stringListValue(node *yaml.Node) ([]string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return []string{node.Value}, nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, errors.New("must be a string or list of strings")
+	}
+
+	var values []string
+	for _, item := range node.Content {
+		if item.Kind != yaml.ScalarNode {
+			return nil, errors.New("must be a string or list of strings")
+		}
+		values = append(values, item.Value)
+	}
+	return values, nil
+}
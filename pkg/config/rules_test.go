@@ -0,0 +1,95 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRuleFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// Error expected, after the file's path
+		err   string
+		rules []string
+	}{
+		{
+			name:    "rule with metadata",
+			content: "rules:\n  - name: Acme\n    categories: [CMS]\n    headers:\n      X-Powered-By: Acme\n",
+			rules:   []string{"Acme"},
+		},
+		{
+			name:    "documents",
+			content: "name: Acme\ntext: acme\n---\n- name: Other\n  text: other\n",
+			rules:   []string{"Acme", "Other"},
+		},
+		{
+			name:    "syntax error",
+			content: "- name: Acme\n  text: [acme,\n",
+			err:     ":2: did not find expected node content",
+		},
+		{
+			name:    "syntax error without a line",
+			content: "name: \x01",
+			err:     ": control characters are not allowed",
+		},
+		{
+			name:    "invalid regex",
+			content: "- name: Acme\n  text: acme\n- name: Other\n  url: '('\n",
+			err:     ":4: url: error parsing regexp: missing closing ): `(`",
+		},
+		{
+			name:    "key defined twice",
+			content: "name: Acme\ntext: acme\nTEXT: other\n",
+			err:     ":3: TEXT is defined more than once",
+		},
+		{
+			name:    "no name",
+			content: "- text: acme\n",
+			err:     ":1: rule has no name",
+		},
+		{
+			name:    "no match sources",
+			content: "- name: Acme\n  tags: [php]\n",
+			err:     ":1: rule Acme has no match sources",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.Repeat("r", i+1)+".yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rules, err := parseRuleFile(path)
+			if tt.err != "" {
+				if err == nil || err.Error() != path+tt.err {
+					t.Fatalf("parseRuleFile() error = %v, want %v", err, path+tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, rule := range rules {
+				names = append(names, rule.app.Name)
+			}
+			if !reflect.DeepEqual(names, tt.rules) {
+				t.Errorf("rules = %v, want %v", names, tt.rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package matcher
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// Certificate summarizes the leaf certificate presented by a host over TLS
+type Certificate struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Sans      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	KeyType   string    `json:"key_type"`
+}
+
+func NewCertificate(cert *x509.Certificate) *Certificate {
+	certificate := &Certificate{
+		Issuer:    cert.Issuer.String(),
+		Subject:   cert.Subject.String(),
+		Sans:      cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		KeyType:   cert.PublicKeyAlgorithm.String(),
+	}
+	for _, ip := range cert.IPAddresses {
+		certificate.Sans = append(certificate.Sans, ip.String())
+	}
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		certificate.KeyType = fmt.Sprintf("RSA %v", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		certificate.KeyType = "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		certificate.KeyType = "Ed25519"
+	}
+	return certificate
+}
+
+// fields returns the values custom certificate rules are matched against: the issuer, subject and SANs
+func (c *Certificate) fields() []string {
+	return append([]string{c.Issuer, c.Subject}, c.Sans...)
+}
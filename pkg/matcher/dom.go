@@ -0,0 +1,172 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// ErrDomProperties is returned for DOM rules checking JavaScript properties (i.e. _reactRootContainer), which are set
+// on elements at runtime and can't be seen in the page's HTML
+var ErrDomProperties = errors.New("properties are set by JavaScript at runtime, so they can't be matched")
+
+// DomRule matches elements in the page's HTML by CSS selector, optionally checking their text and attributes. Rules
+// with Exists set to false match pages without any such element
+type DomRule struct {
+	Selector   string
+	Exists     bool
+	Text       *regexp.Regexp
+	Attributes map[string]*regexp.Regexp
+	compiled   cascadia.Selector
+}
+
+// ParseDomRules parses DOM rules, which are either a selector, a list of selectors, or a map of selectors to the
+// checks to run against the elements found (exists, text and attributes). Any invalid rule is an error
+func ParseDomRules(value interface{}) ([]DomRule, error) {
+	rules, errs, err := parseDomRules(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return rules, nil
+}
+
+// ParseWappalyzerDomRules parses DOM rules as ParseDomRules does, skipping invalid rules and rules checking JavaScript
+// properties rather than dropping every rule. The errors of the rules skipped are returned
+func ParseWappalyzerDomRules(value interface{}) ([]DomRule, []error) {
+	rules, errs, err := parseDomRules(value)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return rules, errs
+}
+
+// parseDomRules returns the valid rules, the errors of the invalid ones, and an error if the value isn't a valid
+// format for DOM rules
+func parseDomRules(value interface{}) ([]DomRule, []error, error) {
+	var rules []DomRule
+	var errs []error
+	add := func(rule DomRule, err error) {
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			rules = append(rules, rule)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		add(newDomRule(v, nil))
+	case []interface{}:
+		for _, selector := range v {
+			str, ok := selector.(string)
+			if !ok {
+				errs = append(errs, errors.New(fmt.Sprintf("%v is not a valid selector", selector)))
+				continue
+			}
+			add(newDomRule(str, nil))
+		}
+	case map[string]interface{}:
+		for selector, checks := range v {
+			checkMap, ok := checks.(map[string]interface{})
+			if !ok {
+				errs = append(errs, errors.New(fmt.Sprintf("checks for selector %v must be an object", selector)))
+				continue
+			}
+			add(newDomRule(selector, checkMap))
+		}
+	default:
+		return nil, nil, errors.New(fmt.Sprintf("%v is not a valid DOM rule. It must be a selector, list of selectors or object", value))
+	}
+
+	return rules, errs, nil
+}
+
+func newDomRule(selector string, checks map[string]interface{}) (DomRule, error) {
+	compiled, err := cascadia.Compile(selector)
+	if err != nil {
+		return DomRule{}, errors.New(fmt.Sprintf("invalid selector %v: %v", selector, err))
+	}
+
+	rule := DomRule{Selector: selector, Exists: true, compiled: compiled}
+	for check, value := range checks {
+		switch check {
+		case "exists":
+			// Wappalyzer uses an empty string, as finding any element is the default
+			switch v := value.(type) {
+			case string:
+				if v != "" {
+					return rule, errors.New(fmt.Sprintf("exists for selector %v must be empty, true or false", selector))
+				}
+			case bool:
+				rule.Exists = v
+			default:
+				return rule, errors.New(fmt.Sprintf("exists for selector %v must be empty, true or false", selector))
+			}
+		case "text":
+			if rule.Text, err = compileDomRegex(value); err != nil {
+				return rule, err
+			}
+		case "attributes":
+			values, ok := value.(map[string]interface{})
+			if !ok {
+				return rule, errors.New(fmt.Sprintf("%v for selector %v must be an object", check, selector))
+			}
+			rule.Attributes = map[string]*regexp.Regexp{}
+			for name, v := range values {
+				if rule.Attributes[name], err = compileDomRegex(v); err != nil {
+					return rule, err
+				}
+			}
+		case "properties":
+			return rule, errors.New(fmt.Sprintf("selector %v: %v", selector, ErrDomProperties))
+		default:
+			return rule, errors.New(fmt.Sprintf("%v is not a valid DOM check. Available checks are: exists, text, attributes", check))
+		}
+	}
+
+	if !rule.Exists && (rule.Text != nil || rule.Attributes != nil) {
+		return rule, errors.New(fmt.Sprintf("selector %v can't check the text or attributes of elements that must not exist", selector))
+	}
+	return rule, nil
+}
+
+// compileDomRegex compiles a regex value, dropping any Wappalyzer tags (i.e. \;version:\1) after it
+func compileDomRegex(value interface{}) (*regexp.Regexp, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%v is not a string", value))
+	}
+	return regexp.Compile(strings.TrimSuffix(strings.Split(str, ";")[0], "\\"))
+}
+
+func (dr *DomRule) matches(doc *goquery.Document) bool {
+	found := false
+	doc.FindMatcher(dr.compiled).EachWithBreak(func(i int, item *goquery.Selection) bool {
+		if dr.Text != nil && !dr.Text.MatchString(item.Text()) {
+			return true
+		}
+		if !attributesMatch(item, dr.Attributes) {
+			return true
+		}
+		found = true
+		return false
+	})
+	return found == dr.Exists
+}
+
+func attributesMatch(item *goquery.Selection, attributes map[string]*regexp.Regexp) bool {
+	for name, match := range attributes {
+		value, exists := item.Attr(name)
+		if !exists || !match.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
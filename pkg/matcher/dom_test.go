@@ -0,0 +1,66 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestDomRules(t *testing.T) {
+	page := `<html><body><div id="app" data-v-app=""></div><footer>Powered by Ghost</footer></body></html>`
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rule interface{}
+		// Number of rules parsed and skipped by ParseWappalyzerDomRules, and whether any of the rules parsed match
+		rules   int
+		skipped int
+		matches bool
+	}{
+		{name: "selector", rule: "div#app[data-v-app]", rules: 1, matches: true},
+		{name: "selector not found", rule: "div#root", rules: 1},
+		{name: "text", rule: map[string]interface{}{"footer": map[string]interface{}{"text": "Ghost"}}, rules: 1, matches: true},
+		{name: "wappalyzer exists", rule: map[string]interface{}{"footer": map[string]interface{}{"exists": ""}}, rules: 1, matches: true},
+		{name: "exists false", rule: map[string]interface{}{"meta[name=generator]": map[string]interface{}{"exists": false}}, rules: 1, matches: true},
+		{name: "exists false with element", rule: map[string]interface{}{"footer": map[string]interface{}{"exists": false}}, rules: 1},
+		{name: "invalid exists", rule: map[string]interface{}{"footer": map[string]interface{}{"exists": "yes"}}, skipped: 1},
+		{name: "invalid selector skipped", rule: []interface{}{"div[", "footer"}, rules: 1, skipped: 1, matches: true},
+		{
+			name: "properties skipped",
+			rule: map[string]interface{}{
+				"#app":   map[string]interface{}{"properties": map[string]interface{}{"__vue__": ""}},
+				"footer": map[string]interface{}{"exists": ""},
+			},
+			rules:   1,
+			skipped: 1,
+			matches: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, errs := ParseWappalyzerDomRules(tt.rule)
+			if len(rules) != tt.rules || len(errs) != tt.skipped {
+				t.Fatalf("ParseWappalyzerDomRules() = %v rules, %v skipped (%v), want %v, %v", len(rules), len(errs), errs, tt.rules, tt.skipped)
+			}
+
+			// Custom rules are strict, so any rule skipped is an error
+			if _, err := ParseDomRules(tt.rule); (err != nil) != (tt.skipped > 0) {
+				t.Errorf("ParseDomRules() error = %v, want error: %v", err, tt.skipped > 0)
+			}
+
+			matches := false
+			for i := range rules {
+				matches = matches || rules[i].matches(doc)
+			}
+			if matches != tt.matches {
+				t.Errorf("matches = %v, want %v", matches, tt.matches)
+			}
+		})
+	}
+}
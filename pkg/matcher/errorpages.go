@@ -0,0 +1,91 @@
+package matcher
+
+import "regexp"
+
+// ErrorPageRules identify frameworks and servers by their default error pages, which often give away what a landing
+// page hides. Technologies are named as in the Wappalyzer dataset, so matches merge with its matches. The first group
+// captured by a rule is the version. Each rule must identify the technology on its own, so stock pages shared by several
+// technologies (i.e. Werkzeug's 404 page, served by Flask and other apps) aren't matched
+var ErrorPageRules = map[string]AppMatch{
+	"apache tomcat": errorPageRule("Apache Tomcat",
+		`<h3>Apache Tomcat(?:/([\d.]+))?</h3>`,
+		`(?i)<title>Apache Tomcat(?:/([\d.]+))? - Error report</title>`,
+		`HTTP Status \d{3} [-–] [^<]+</h1>.*Apache Tomcat`,
+	),
+	"iis": errorPageRule("IIS",
+		`<title>IIS (\d+\.\d+) Detailed Error`,
+		`<h2>404 - File or directory not found\.</h2>`,
+		`The page you are requesting cannot be served because of the extension configuration`,
+	),
+	"microsoft asp.net": errorPageRule("Microsoft ASP.NET",
+		`Server Error in '[^']*' Application\.`,
+		`ASP\.NET Version:([\d.]+)`,
+	),
+	"django": errorPageRule("Django",
+		`You're seeing this error because you have <code>DEBUG = True</code>`,
+		`Using the URLconf defined in <code>`,
+	),
+	"express": errorPageRule("Express",
+		`<title>Error</title>\s*</head>\s*<body>\s*<pre>Cannot (?:GET|POST|HEAD) /[^<]*</pre>`,
+	),
+	"spring": errorPageRule("Spring",
+		`<h1>Whitelabel Error Page</h1>`,
+		`This application has no explicit mapping for /error`,
+	),
+	"laravel": errorPageRule("Laravel",
+		`class="flex-center position-ref full-height".*Sorry, the page you are looking for could not be found\.`,
+		`<div class="[^"]*border-r border-gray-400[^"]*">\s*404\s*</div>\s*<div class="[^"]*">\s*Not Found\s*</div>`,
+	),
+	"symfony": errorPageRule("Symfony",
+		`<h1 class="break-long-words exception-message">`,
+		`<h1>Oops! An Error Occurred</h1>\s*<h2>The server returned a "\d{3} [^"]+"\.</h2>`,
+	),
+	"nginx": errorPageRule("Nginx",
+		`<hr><center>nginx(?:/([\d.]+))?</center>`,
+	),
+	"apache": errorPageRule("Apache",
+		`<address>Apache(?:/([\d.]+))?[^<]* Server at [^<]+</address>`,
+	),
+	"jetty": errorPageRule("Jetty",
+		`Powered by Jetty:// ?([\d.]+[^<\s]*)?`,
+	),
+	"ruby on rails": errorPageRule("Ruby on Rails",
+		`<h1>The page you were looking for doesn't exist\.</h1>\s*<p>You may have mistyped the address or the page may have moved\.</p>`,
+		`<title>Action Controller: Exception caught</title>`,
+	),
+	"next.js": errorPageRule("Next.js",
+		`<h1 class="next-error-h1"`,
+		`id="__next".*<h2[^>]*>This page could not be found\.?</h2>`,
+	),
+	"oracle weblogic server": errorPageRule("Oracle WebLogic Server",
+		`<H4>Error 404--Not Found</H4>`,
+		`From RFC 2068 <i>Hypertext Transfer Protocol -- HTTP/1\.1</i>`,
+	),
+}
+
+func errorPageRule(name string, patterns ...string) AppMatch {
+	match := Matcher{}
+	for _, pattern := range patterns {
+		match.ErrorPage = append(match.ErrorPage, regexp.MustCompile(`(?s)`+pattern))
+	}
+	return AppMatch{Name: name, Matches: &match}
+}
+
+// EvaluateErrorPages matches the error pages returned by a host against the technology's error page rules, adding
+// matches with the errorPage match type
+func (m *Matcher) EvaluateErrorPages(tech string, responses []*ProbeResponse, matchResult *MatchResult) {
+	for _, resp := range responses {
+		for _, match := range m.ErrorPage {
+			groups := match.FindStringSubmatch(resp.Body)
+			if groups == nil {
+				continue
+			}
+
+			matchResult.addMatches(tech, []string{"errorPage"})
+			if len(groups) > 1 {
+				matchResult.setVersion(tech, groups[1])
+			}
+			return
+		}
+	}
+}
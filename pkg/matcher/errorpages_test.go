@@ -0,0 +1,81 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestErrorPageRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		version string
+	}{
+		{
+			name:    "tomcat",
+			body:    `<html><head><title>HTTP Status 404 – Not Found</title></head><body><h1>HTTP Status 404 – Not Found</h1><hr class="line" /><h3>Apache Tomcat/9.0.41</h3></body></html>`,
+			want:    []string{"apache tomcat"},
+			version: "9.0.41",
+		},
+		{
+			name: "express",
+			body: "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>Error</title>\n</head>\n<body>\n<pre>Cannot GET /whoareyou-1a2b</pre>\n</body>\n</html>",
+			want: []string{"express"},
+		},
+		{
+			name: "symfony",
+			body: "<h1>Oops! An Error Occurred</h1>\n<h2>The server returned a \"404 Not Found\".</h2>",
+			want: []string{"symfony"},
+		},
+		{
+			name: "ruby on rails",
+			body: "<div class=\"dialog\">\n<div>\n<h1>The page you were looking for doesn't exist.</h1>\n<p>You may have mistyped the address or the page may have moved.</p>\n</div>",
+			want: []string{"ruby on rails"},
+		},
+		{
+			name: "next.js",
+			body: `<div id="__next"><div><h1 class="next-error-h1" style="display:inline-block">404</h1><div><h2 style="font-size:14px">This page could not be found.</h2></div></div></div>`,
+			want: []string{"next.js"},
+		},
+		{
+			name:    "nginx",
+			body:    "<html>\n<head><title>404 Not Found</title></head>\n<body>\n<center><h1>404 Not Found</h1></center>\n<hr><center>nginx/1.18.0</center>\n</body>\n</html>",
+			want:    []string{"nginx"},
+			version: "1.18.0",
+		},
+		{
+			name: "werkzeug is shared by several frameworks",
+			body: "<!doctype html>\n<html lang=en>\n<title>404 Not Found</title>\n<h1>Not Found</h1>\n<p>The requested URL was not found on the server. If you entered the URL manually please check your spelling and try again.</p>",
+		},
+		{
+			name: "generic oops page",
+			body: "<h1>Oops! An Error Occurred</h1><p>Please try again later.</p>",
+		},
+		{
+			name: "generic not found page",
+			body: "<div class=\"code\">404</div><div class=\"message\">Not Found</div><p>Sorry, the page you are looking for could not be found.</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := MatchResult{TechnologyMatches: map[string][]string{}}
+			responses := []*ProbeResponse{{StatusCode: 404, Body: tt.body}}
+			for key, app := range ErrorPageRules {
+				app.Matches.EvaluateErrorPages(key, responses, &result)
+			}
+
+			var got []string
+			for tech := range result.TechnologyMatches {
+				got = append(got, tech)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("technologies = %v, want %v", got, tt.want)
+			}
+			if tt.version != "" && result.Versions[tt.want[0]] != tt.version {
+				t.Errorf("version = %v, want %v", result.Versions[tt.want[0]], tt.version)
+			}
+		})
+	}
+}
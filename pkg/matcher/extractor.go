@@ -1,14 +1,54 @@
 package matcher
 
 import (
+	"regexp"
+	"strings"
+
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 )
 
+// Simple JavaScript redirects, i.e. window.location = "/app" or location.replace('/app'). The location must not be part
+// of another name (i.e. geolocation or myLocation.assign), and variables declared as location (captured first) are not
+// redirects
+const jsRedirectPrefix = `(?:^|[^\w$.])((?:var|let|const)\s+)?(?:(?:window|document|top|self)\.)?location`
+
+var jsRedirectRegexes = []*regexp.Regexp{
+	regexp.MustCompile(jsRedirectPrefix + `(?:\.href)?\s*=\s*["']([^"']+)["']`),
+	regexp.MustCompile(jsRedirectPrefix + `\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\)`),
+}
+
+// Elements whose content is never shown on the page
+var hiddenElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+	"object": true, "canvas": true,
+}
+
+// Elements that separate their text from the surrounding text, unlike inline elements (i.e. a, b or span)
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true, "dl": true,
+	"dt": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+	"option": true, "button": true, "label": true,
+}
+
 type HtmlExtractions struct {
 	ScriptTags       []string
 	InlineJavaScript []string
 	MetaTags         map[string]string
 	RawHtmlBody      *string
+	// Destination of a meta refresh or JavaScript redirect on the page, if any
+	ClientRedirect string
+	// Links and form actions on the page, as they appear in the HTML (possibly relative)
+	Links []string
+	// Linked stylesheets (possibly relative) and the content of inline style tags
+	Stylesheets []string
+	InlineCss   []string
+	// Icons linked from the page (possibly relative)
+	Icons []string
+	// Text shown on the page, without markup, scripts or styles, and with whitespace collapsed
+	VisibleText string
 }
 
 func (he *HtmlExtractions) getScriptTags(doc *goquery.Document) {
@@ -38,8 +78,126 @@ func (he *HtmlExtractions) getInlineJavaScript(doc *goquery.Document) {
 	he.InlineJavaScript = inlineJS
 }
 
+func (he *HtmlExtractions) getClientRedirect(doc *goquery.Document) {
+	doc.Find("meta").EachWithBreak(func(i int, item *goquery.Selection) bool {
+		if httpEquiv, _ := item.Attr("http-equiv"); !strings.EqualFold(httpEquiv, "refresh") {
+			return true
+		}
+
+		// Content is formatted as: 0; url=https://example.com
+		content, _ := item.Attr("content")
+		parts := strings.SplitN(content, ";", 2)
+		if len(parts) < 2 {
+			return true
+		}
+		destination := strings.TrimSpace(parts[1])
+		if strings.HasPrefix(strings.ToLower(destination), "url=") {
+			destination = strings.TrimSpace(destination[4:])
+		}
+		he.ClientRedirect = strings.Trim(destination, `"'`)
+		return he.ClientRedirect == ""
+	})
+
+	if he.ClientRedirect != "" {
+		return
+	}
+
+	for _, js := range he.InlineJavaScript {
+		for _, re := range jsRedirectRegexes {
+			for _, match := range re.FindAllStringSubmatch(js, -1) {
+				if match[1] == "" {
+					he.ClientRedirect = match[2]
+					return
+				}
+			}
+		}
+	}
+}
+
+func (he *HtmlExtractions) getLinks(doc *goquery.Document) {
+	var links []string
+	doc.Find("a[href], area[href], iframe[src], form[action]").Each(func(i int, item *goquery.Selection) {
+		for _, attr := range []string{"href", "src", "action"} {
+			if link, exists := item.Attr(attr); exists && strings.TrimSpace(link) != "" {
+				links = append(links, strings.TrimSpace(link))
+			}
+		}
+	})
+	he.Links = links
+}
+
+func (he *HtmlExtractions) getStylesheets(doc *goquery.Document) {
+	var stylesheets []string
+	doc.Find("link[href]").Each(func(i int, item *goquery.Selection) {
+		rel, _ := item.Attr("rel")
+		if !strings.Contains(strings.ToLower(rel), "stylesheet") {
+			return
+		}
+		if href, _ := item.Attr("href"); strings.TrimSpace(href) != "" {
+			stylesheets = append(stylesheets, strings.TrimSpace(href))
+		}
+	})
+	he.Stylesheets = stylesheets
+
+	var inlineCss []string
+	doc.Find("style").Each(func(i int, item *goquery.Selection) {
+		inlineCss = append(inlineCss, item.Text())
+	})
+	he.InlineCss = inlineCss
+}
+
+func (he *HtmlExtractions) getIcons(doc *goquery.Document) {
+	var icons []string
+	doc.Find("link[href]").Each(func(i int, item *goquery.Selection) {
+		rel, _ := item.Attr("rel")
+		if !strings.Contains(strings.ToLower(rel), "icon") {
+			return
+		}
+		if href, _ := item.Attr("href"); strings.TrimSpace(href) != "" {
+			icons = append(icons, strings.TrimSpace(href))
+		}
+	})
+	he.Icons = icons
+}
+
+func (he *HtmlExtractions) getVisibleText(doc *goquery.Document) {
+	var text strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		switch node.Type {
+		case html.TextNode:
+			text.WriteString(node.Data)
+			return
+		case html.CommentNode:
+			return
+		case html.ElementNode:
+			if hiddenElements[node.Data] {
+				return
+			}
+			if blockElements[node.Data] {
+				text.WriteString(" ")
+				defer text.WriteString(" ")
+			}
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+
+	for _, node := range doc.Nodes {
+		walk(node)
+	}
+	he.VisibleText = strings.Join(strings.Fields(text.String()), " ")
+}
+
 func (he *HtmlExtractions) Parse(doc *goquery.Document) {
 	he.getScriptTags(doc)
 	he.getMetaTags(doc)
 	he.getInlineJavaScript(doc)
+	he.getClientRedirect(doc)
+	he.getLinks(doc)
+	he.getStylesheets(doc)
+	he.getIcons(doc)
+	he.getVisibleText(doc)
 }
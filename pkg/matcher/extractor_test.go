@@ -0,0 +1,48 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestClientRedirect(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{name: "meta refresh", html: `<meta http-equiv="refresh" content="0; url='/app'">`, want: "/app"},
+		{name: "location", html: `<script>location = "/app";</script>`, want: "/app"},
+		{name: "window location href", html: `<script>window.location.href='/app'</script>`, want: "/app"},
+		{name: "location replace", html: `<script>if (x) { top.location.replace("/login") }</script>`, want: "/login"},
+		{name: "start of script", html: `<script>location.assign('/app')</script>`, want: "/app"},
+		{name: "geolocation", html: `<script>geolocation = "x";</script>`},
+		{name: "variable named location", html: `<script>var location = "Paris";</script>`},
+		{name: "let location", html: `<script>let location = 'Paris'</script>`},
+		{name: "property named location", html: `<script>user.location = "Paris";</script>`},
+		{name: "method of another object", html: `<script>myLocation.assign('x')</script>`},
+		{name: "comparison", html: `<script>if (location == "/") {}</script>`},
+		{
+			name: "redirect after a variable named location",
+			html: `<script>var location = "Paris"; window.location = "/fr";</script>`,
+			want: "/fr",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			he := HtmlExtractions{MetaTags: map[string]string{}}
+			he.Parse(doc)
+			if he.ClientRedirect != tt.want {
+				t.Errorf("ClientRedirect = %q, want %q", he.ClientRedirect, tt.want)
+			}
+		})
+	}
+}
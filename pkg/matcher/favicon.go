@@ -0,0 +1,114 @@
+package matcher
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Favicon is an icon fetched for a page, with the hashes it can be looked up by
+type Favicon struct {
+	Url string `json:"url"`
+	// MurmurHash3 of the base64 encoded icon, as used by Shodan (http.favicon.hash)
+	Mmh3   string `json:"mmh3"`
+	Md5    string `json:"md5"`
+	Sha256 string `json:"sha256"`
+}
+
+func NewFavicon(u string, content []byte) Favicon {
+	md5Sum := md5.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	return Favicon{
+		Url:    u,
+		Mmh3:   strconv.Itoa(int(int32(murmur3([]byte(shodanBase64(content)))))),
+		Md5:    hex.EncodeToString(md5Sum[:]),
+		Sha256: hex.EncodeToString(sha256Sum[:]),
+	}
+}
+
+func (f *Favicon) hashes() []string {
+	return []string{f.Mmh3, f.Md5, f.Sha256}
+}
+
+// MergeFavicons adds favicons to a list, skipping those already in it
+func MergeFavicons(favicons []Favicon, others []Favicon) []Favicon {
+	for _, other := range others {
+		found := false
+		for _, favicon := range favicons {
+			if favicon.Url == other.Url && favicon.Sha256 == other.Sha256 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			favicons = append(favicons, other)
+		}
+	}
+	return favicons
+}
+
+// shodanBase64 encodes content as Python's base64.encodebytes does, which is what Shodan hashes: lines of 76
+// characters, each ending with a newline
+func shodanBase64(content []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	var builder strings.Builder
+	for len(encoded) > 76 {
+		builder.WriteString(encoded[:76])
+		builder.WriteString("\n")
+		encoded = encoded[76:]
+	}
+	if encoded != "" {
+		builder.WriteString(encoded)
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// murmur3 is the 32 bit x86 variant of MurmurHash3, with a seed of 0
+func murmur3(data []byte) uint32 {
+	const c1 = 0xcc9e2d51
+	const c2 = 0x1b873593
+
+	var hash uint32
+	blocks := len(data) / 4
+	for i := 0; i < blocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		hash ^= k
+		hash = bits.RotateLeft32(hash, 13)
+		hash = hash*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[blocks*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		hash ^= k
+	}
+
+	hash ^= uint32(len(data))
+	hash ^= hash >> 16
+	hash *= 0x85ebca6b
+	hash ^= hash >> 13
+	hash *= 0xc2b2ae35
+	hash ^= hash >> 16
+	return hash
+}
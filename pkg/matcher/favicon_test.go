@@ -0,0 +1,52 @@
+package matcher
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	// Published MurmurHash3_x86_32 test vectors, with a seed of 0
+	tests := []struct {
+		input string
+		want  uint32
+	}{
+		{input: "", want: 0},
+		{input: "a", want: 0x3c2569b2},
+		{input: "abc", want: 0xb3dd93fa},
+		{input: "test", want: 0xba6bd213},
+		{input: "hello", want: 0x248bfa47},
+		{input: "Hello, world!", want: 0xc0363e43},
+		{input: "The quick brown fox jumps over the lazy dog", want: 0x2e4ff723},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := murmur3([]byte(tt.input)); got != tt.want {
+				t.Errorf("murmur3(%q) = %#x, want %#x", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFavicon(t *testing.T) {
+	// A 1x1 icon, long enough for its base64 encoding to be split over two lines. The hash is Shodan's
+	// http.favicon.hash for it, computed as Shodan does: mmh3.hash(codecs.encode(icon, "base64"))
+	icon, _ := hex.DecodeString("0000010001000101000001002000300000001600000028000000010000000200000001002000000000000800000000000000" +
+		"000000000000000000000000ff5722ff00000000")
+
+	encoded := "AAABAAEAAQEAAAEAIAAwAAAAFgAAACgAAAABAAAAAgAAAAEAIAAAAAAACAAAAAAAAAAAAAAAAAAA\nAAAAAAD/VyL/AAAAAA==\n"
+	if got := shodanBase64(icon); got != encoded {
+		t.Errorf("shodanBase64() = %q, want %q", got, encoded)
+	}
+
+	want := Favicon{
+		Url:    "https://example.com/favicon.ico",
+		Mmh3:   "1203515694",
+		Md5:    "0cb2b42acc976868105fe1bc230a9e3f",
+		Sha256: "70fcbeea67381743793ca2ca5f8c5118a0c560b2535788980263bd0fac84ef04",
+	}
+	if got := NewFavicon("https://example.com/favicon.ico", icon); got != want {
+		t.Errorf("NewFavicon() = %+v, want %+v", got, want)
+	}
+}
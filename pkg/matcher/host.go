@@ -0,0 +1,102 @@
+package matcher
+
+import (
+	"sort"
+	"sync"
+)
+
+type HostResult struct {
+	Host      string   `json:"host"`
+	TechFound []string `json:"technologies"`
+	// Evidence maps each technology found to the sources (i.e. URLs) it was found in
+	Evidence map[string][]string    `json:"evidence"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Metadata of the rules of technologies found, when they have any
+	TechnologyInfo map[string]*TechnologyInfo `json:"technology_info,omitempty"`
+	// Icons fetched for the host's pages, and their hashes
+	Favicons    []Favicon           `json:"favicons,omitempty"`
+	Certificate *Certificate        `json:"certificate,omitempty"`
+	Dns         map[string][]string `json:"dns,omitempty"`
+	SiteFiles   *SiteFiles          `json:"site_files,omitempty"`
+}
+
+type HostResults struct {
+	hosts map[string]*HostResult
+	mu    sync.Mutex
+}
+
+func NewHostResults() *HostResults {
+	return &HostResults{
+		hosts: make(map[string]*HostResult),
+	}
+}
+
+// Add merges the technologies found for a URL scanned into the host's results, along with the favicons, certificate,
+// DNS records and site files found
+func (hr *HostResults) Add(host string, matchResult *MatchResult) {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	result, ok := hr.hosts[host]
+	if !ok {
+		result = &HostResult{
+			Host:      host,
+			TechFound: []string{},
+			Evidence:  map[string][]string{},
+			Metadata:  matchResult.Metadata,
+		}
+		hr.hosts[host] = result
+	}
+
+	for _, tech := range matchResult.TechFound {
+		evidence, seen := result.Evidence[tech]
+		if !seen {
+			result.TechFound = append(result.TechFound, tech)
+		}
+		if !containsString(evidence, matchResult.Url) {
+			result.Evidence[tech] = append(evidence, matchResult.Url)
+		}
+	}
+	for tech, info := range matchResult.TechnologyInfo {
+		if result.TechnologyInfo == nil {
+			result.TechnologyInfo = map[string]*TechnologyInfo{}
+		}
+		result.TechnologyInfo[tech] = info
+	}
+	result.Favicons = MergeFavicons(result.Favicons, matchResult.Favicons)
+	if result.Certificate == nil {
+		result.Certificate = matchResult.Certificate
+	}
+	if result.Dns == nil {
+		result.Dns = matchResult.Dns
+	}
+	if result.SiteFiles == nil {
+		result.SiteFiles = matchResult.SiteFiles
+	}
+}
+
+// Results returns the results of every host, sorted by host
+func (hr *HostResults) Results() []*HostResult {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	var results []*HostResult
+	for _, result := range hr.hosts {
+		sort.Strings(result.TechFound)
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Host < results[j].Host
+	})
+	return results
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
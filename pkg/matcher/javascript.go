@@ -0,0 +1,259 @@
+package matcher
+
+import (
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Maximum depth of nested calls in page scripts, so runaway recursion fails instead of exhausting memory
+const jsMaxCallStackSize = 1024
+
+// Time allowed to read globals once the page's scripts have run, as reading a property can run a getter
+const jsLookupTimeout = 100 * time.Millisecond
+
+// browserStub is run before a page's scripts to stand in for the browser environment most scripts expect. The DOM is
+// empty, so scripts querying it find nothing, but they can still create elements, register listeners and set timers.
+// Timer and load event callbacks are queued, to be run once all scripts have run. The lookup function returned reads a
+// dotted path from the global object, returning its value as Wappalyzer does (strings and numbers as is, anything else
+// as a boolean), or null if it isn't defined
+const browserStub = `(function (g) {
+	var noop = function () {};
+	var callbacks = [];
+	var queue = function (fn) {
+		if (typeof fn === "function") {
+			callbacks.push(fn);
+		}
+		return callbacks.length;
+	};
+	var listeners = {
+		addEventListener: function (type, fn) {
+			if (type === "DOMContentLoaded" || type === "load" || type === "readystatechange") {
+				queue(fn);
+			}
+		},
+		removeEventListener: noop,
+		dispatchEvent: function () { return true; }
+	};
+	var element = function (tagName) {
+		var el = {
+			tagName: String(tagName || "div").toUpperCase(),
+			style: {},
+			dataset: {},
+			attributes: [],
+			childNodes: [],
+			children: [],
+			classList: { add: noop, remove: noop, toggle: noop, contains: function () { return false; } },
+			setAttribute: noop,
+			getAttribute: function () { return null; },
+			hasAttribute: function () { return false; },
+			removeAttribute: noop,
+			appendChild: function (child) { return child; },
+			removeChild: function (child) { return child; },
+			insertBefore: function (child) { return child; },
+			querySelector: function () { return null; },
+			querySelectorAll: function () { return []; },
+			getElementsByTagName: function () { return []; },
+			getElementsByClassName: function () { return []; },
+			cloneNode: function () { return element(tagName); },
+			getBoundingClientRect: function () { return { top: 0, left: 0, right: 0, bottom: 0, width: 0, height: 0 }; }
+		};
+		el.addEventListener = noop;
+		el.removeEventListener = noop;
+		return el;
+	};
+	var storage = function () {
+		var items = {};
+		return {
+			getItem: function (k) { return items.hasOwnProperty(k) ? items[k] : null; },
+			setItem: function (k, v) { items[k] = String(v); },
+			removeItem: function (k) { delete items[k]; },
+			clear: function () { items = {}; }
+		};
+	};
+
+	var document = element("#document");
+	document.readyState = "loading";
+	document.cookie = "";
+	document.referrer = "";
+	document.title = "";
+	document.documentElement = element("html");
+	document.head = element("head");
+	document.body = element("body");
+	document.createElement = element;
+	document.createElementNS = function (ns, tagName) { return element(tagName); };
+	document.createTextNode = function () { return element("#text"); };
+	document.createDocumentFragment = function () { return element("#document-fragment"); };
+	document.getElementById = function () { return null; };
+	document.getElementsByName = function () { return []; };
+	document.addEventListener = listeners.addEventListener;
+	document.removeEventListener = noop;
+	document.write = noop;
+	document.writeln = noop;
+
+	g.window = g.self = g.top = g.parent = g.globalThis = g;
+	g.document = document;
+	g.navigator = { userAgent: "Mozilla/5.0", language: "en-US", languages: ["en-US"], platform: "", cookieEnabled: true, plugins: [] };
+	g.screen = { width: 1920, height: 1080 };
+	g.history = { length: 1, pushState: noop, replaceState: noop, back: noop, forward: noop };
+	g.localStorage = storage();
+	g.sessionStorage = storage();
+	g.console = { log: noop, info: noop, warn: noop, error: noop, debug: noop, trace: noop };
+	g.addEventListener = listeners.addEventListener;
+	g.removeEventListener = noop;
+	g.dispatchEvent = listeners.dispatchEvent;
+	g.setTimeout = g.setInterval = g.setImmediate = g.requestAnimationFrame = queue;
+	g.clearTimeout = g.clearInterval = g.clearImmediate = g.cancelAnimationFrame = noop;
+	g.getComputedStyle = function () { return { getPropertyValue: function () { return ""; } }; };
+	g.matchMedia = function () { return { matches: false, addListener: noop, removeListener: noop }; };
+	g.XMLHttpRequest = function () {
+		return { open: noop, send: noop, setRequestHeader: noop, abort: noop, addEventListener: noop, readyState: 0 };
+	};
+	g.fetch = function () { return { then: function () { return this; }, catch: function () { return this; } }; };
+	g.Image = function () { return element("img"); };
+	g.innerWidth = 1920;
+	g.innerHeight = 1080;
+	g.devicePixelRatio = 1;
+
+	return {
+		runCallbacks: function () {
+			document.readyState = "complete";
+			// Callbacks can queue more callbacks, so limit how many run
+			for (var i = 0; i < callbacks.length && i < 1000; i++) {
+				try {
+					callbacks[i].call(g, {});
+				} catch (e) {}
+			}
+		},
+		lookup: function (path) {
+			var value = g;
+			var parts = path.split(".");
+			for (var i = 0; i < parts.length; i++) {
+				if (value === undefined || value === null) {
+					return null;
+				}
+				value = value[parts[i]];
+			}
+			if (value === undefined) {
+				return null;
+			}
+			if (typeof value === "string" || typeof value === "number") {
+				return String(value);
+			}
+			return String(!!value);
+		}
+	};
+})(this)`
+
+// EvaluateJavaScript runs a page's scripts in a sandboxed interpreter with a stubbed browser environment, and returns
+// the value of each global given that is defined once they have run. Scripts are stopped once the timeout is reached,
+// and errors in a script don't stop the following scripts from running, as in a browser. Only the running time and call
+// stack size of scripts are limited, not the memory they allocate, which is bounded by the size of the scripts run and
+// the timeout
+func EvaluateJavaScript(pageUrl string, scripts []string, globals []string, timeout time.Duration) map[string]string {
+	values := map[string]string{}
+	if len(scripts) == 0 || len(globals) == 0 {
+		return values
+	}
+
+	vm := goja.New()
+	vm.SetMaxCallStackSize(jsMaxCallStackSize)
+
+	stub, err := vm.RunString(browserStub)
+	if err != nil {
+		return values
+	}
+	sandbox := stub.ToObject(vm)
+	runCallbacks, _ := goja.AssertFunction(sandbox.Get("runCallbacks"))
+	lookup, _ := goja.AssertFunction(sandbox.Get("lookup"))
+	vm.Set("location", jsLocation(pageUrl))
+
+	// Interrupt scripts still running once the timeout is reached, i.e. infinite loops or heavy computation. Callbacks
+	// queued by the scripts (i.e. with setTimeout) run within the same timeout, and are skipped once it's reached
+	timer := time.AfterFunc(timeout, func() {
+		vm.Interrupt("timeout")
+	})
+	interrupted := false
+	for _, script := range scripts {
+		if _, err := vm.RunString(script); err != nil {
+			if _, ok := err.(*goja.InterruptedError); ok {
+				interrupted = true
+				break
+			}
+		}
+	}
+	if !interrupted {
+		// Errors thrown by callbacks are caught by the stub, so anything other than an interrupt means the sandbox broke
+		if _, err := runCallbacks(goja.Undefined()); err != nil {
+			if _, ok := err.(*goja.InterruptedError); !ok {
+				timer.Stop()
+				return values
+			}
+		}
+	}
+	timer.Stop()
+
+	// The interrupt can fire after the scripts finished, so it's cleared before looking up globals either way
+	vm.ClearInterrupt()
+	timer = time.AfterFunc(jsLookupTimeout, func() {
+		vm.Interrupt("timeout")
+	})
+	defer timer.Stop()
+
+	for _, global := range globals {
+		value, err := lookup(goja.Undefined(), vm.ToValue(global))
+		if err != nil {
+			break
+		}
+		if !goja.IsNull(value) {
+			values[global] = value.String()
+		}
+	}
+	return values
+}
+
+// jsLocation builds the window.location object for a page
+func jsLocation(pageUrl string) map[string]interface{} {
+	location := map[string]interface{}{"href": pageUrl}
+	u, err := url.Parse(pageUrl)
+	if err != nil {
+		return location
+	}
+
+	location["protocol"] = u.Scheme + ":"
+	location["host"] = u.Host
+	location["hostname"] = u.Hostname()
+	location["port"] = u.Port()
+	location["pathname"] = u.EscapedPath()
+	location["search"] = ""
+	if u.RawQuery != "" {
+		location["search"] = "?" + u.RawQuery
+	}
+	location["hash"] = ""
+	if u.Fragment != "" {
+		location["hash"] = "#" + u.Fragment
+	}
+	location["origin"] = u.Scheme + "://" + u.Host
+	return location
+}
+
+// JavaScriptGlobals returns the globals checked by the JavaScript rules of the technologies given, so only those are
+// looked up once a page's scripts have run
+func JavaScriptGlobals(apps ...map[string]AppMatch) []string {
+	found := map[string]bool{}
+	var globals []string
+	for _, appMatches := range apps {
+		for _, app := range appMatches {
+			for global := range app.Matches.JavaScript {
+				if !found[global] {
+					found[global] = true
+					globals = append(globals, global)
+				}
+			}
+		}
+	}
+	sort.Strings(globals)
+	return globals
+}
@@ -0,0 +1,72 @@
+package matcher
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluateJavaScript(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	tests := []struct {
+		name    string
+		scripts []string
+		globals []string
+		want    map[string]string
+	}{
+		{
+			name:    "global defined",
+			scripts: []string{`window.jQuery = {fn: {jquery: "3.5.1"}};`},
+			globals: []string{"jQuery.fn.jquery", "React"},
+			want:    map[string]string{"jQuery.fn.jquery": "3.5.1"},
+		},
+		{
+			name:    "error doesn't stop following scripts",
+			scripts: []string{`undefinedFunction();`, `var Vue = {version: "2.6.12"};`},
+			globals: []string{"Vue.version"},
+			want:    map[string]string{"Vue.version": "2.6.12"},
+		},
+		{
+			name:    "callback defines global",
+			scripts: []string{`setTimeout(function () { window.lateGlobal = "yes"; });`},
+			globals: []string{"lateGlobal"},
+			want:    map[string]string{"lateGlobal": "yes"},
+		},
+		{
+			name:    "infinite loop in script",
+			scripts: []string{`var before = 1;`, `for (;;) {}`},
+			globals: []string{"before"},
+			want:    map[string]string{"before": "1"},
+		},
+		{
+			name:    "infinite loop in script and callback",
+			scripts: []string{`var before = 1; setTimeout(function () { for (;;) {} });`, `for (;;) {}`},
+			globals: []string{"before"},
+			want:    map[string]string{"before": "1"},
+		},
+		{
+			name:    "infinite loop in callback",
+			scripts: []string{`var before = 1; setTimeout(function () { for (;;) {} });`},
+			globals: []string{"before"},
+			want:    map[string]string{"before": "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan map[string]string, 1)
+			go func() {
+				done <- EvaluateJavaScript("https://example.com/", tt.scripts, tt.globals, timeout)
+			}()
+
+			select {
+			case got := <-done:
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("EvaluateJavaScript() = %v, want %v", got, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("EvaluateJavaScript() didn't return after the timeout")
+			}
+		})
+	}
+}
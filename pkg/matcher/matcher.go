@@ -1,96 +1,349 @@
 package matcher
 
 import (
+	"net/http"
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/PuerkitoBio/goquery"
 )
 
 type Matcher struct {
 	Cookies         map[string]*regexp.Regexp
 	Headers         map[string]*regexp.Regexp
 	Icon            string
+	Favicon         []*regexp.Regexp
+	CertIssuer      []*regexp.Regexp
+	Cert            []*regexp.Regexp
 	ResponseContent []*regexp.Regexp
+	Text            []*regexp.Regexp
+	Url             []*regexp.Regexp
 	Script          []*regexp.Regexp
+	ScriptContent   []*regexp.Regexp
+	Css             []*regexp.Regexp
+	Dom             []DomRule
 	JavaScript      map[string]*regexp.Regexp
 	Meta            map[string]*regexp.Regexp
-	HtmlExtractions HtmlExtractions
+	// DNS rules by record type (i.e. MX)
+	Dns map[string][]*regexp.Regexp
+	// Rules for the content of site files by file name (i.e. robots)
+	SiteFiles map[string][]*regexp.Regexp
+	// Requests sent to specific endpoints of the host, with rules for their responses
+	Probes []Probe
+	// Rules for the error pages returned for paths that don't exist
+	ErrorPage []*regexp.Regexp
 }
 
 type AppMatch struct {
 	Name    string
 	Website string
 	Matches *Matcher
+	// Metadata of Wappalyzer technologies and of rules loaded from rule files
+	Description string
+	Categories  []string
+	Tags        []string
+}
+
+// TechnologyInfo is the metadata of a Wappalyzer technology or rule file rule, reported with the technologies it matched
+type TechnologyInfo struct {
+	Description string   `json:"description,omitempty"`
+	Website     string   `json:"website,omitempty"`
+	Categories  []string `json:"categories,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Info returns the metadata of a rule, or nil when it has none
+func (a AppMatch) Info() *TechnologyInfo {
+	if a.Description == "" && len(a.Categories) == 0 && len(a.Tags) == 0 {
+		return nil
+	}
+	return &TechnologyInfo{Description: a.Description, Website: a.Website, Categories: a.Categories, Tags: a.Tags}
 }
 
 type MatchResult struct {
-	Url               string
-	TechnologyMatches map[string][]string
-	TechFound         []string
+	Url               string                 `json:"url"`
+	Input             string                 `json:"input,omitempty"`
+	TechnologyMatches map[string][]string    `json:"matches"`
+	TechFound         []string               `json:"technologies"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	// Metadata of the rules of technologies found, when they have any
+	TechnologyInfo map[string]*TechnologyInfo `json:"technology_info,omitempty"`
+	// Number of requests sent before getting a response, including retries
+	Attempts int `json:"attempts"`
+	// The URL of the final response, and the redirects followed to get there
+	FinalUrl  string        `json:"final_url,omitempty"`
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+	// Meta refresh and JavaScript redirects followed from the page
+	ClientRedirects []string `json:"client_redirects,omitempty"`
+	// Versions of the technologies found, when a rule captures one
+	Versions map[string]string `json:"versions,omitempty"`
+	// Icons fetched for the page, and their hashes
+	Favicons []Favicon `json:"favicons,omitempty"`
+	// The TLS certificate presented for the URL
+	Certificate *Certificate `json:"certificate,omitempty"`
+	// DNS records of the host, by record type
+	Dns map[string][]string `json:"dns,omitempty"`
+	// What was found in the host's robots.txt and other well-known files
+	SiteFiles *SiteFiles `json:"site_files,omitempty"`
 }
 
 func (m *Matcher) contentMatch(body *string) bool {
+	// The body is missing when URLs are classified without being requested
+	if body == nil {
+		return false
+	}
 	return strAndSliceMatch(body, m.ResponseContent)
 }
 
-func (m *Matcher) headersMatch(header *string) bool {
-	return strAndMapMatch(header, m.Headers)
+func (m *Matcher) textMatch(text *string) bool {
+	if *text == "" {
+		return false
+	}
+	return strAndSliceMatch(text, m.Text)
+}
+
+func (m *Matcher) urlMatch(urls []string) bool {
+	return sliceAndSliceMatch(&urls, m.Url)
+}
+
+func (m *Matcher) faviconMatch(favicons []Favicon) bool {
+	for _, favicon := range favicons {
+		hashes := favicon.hashes()
+		if sliceAndSliceMatch(&hashes, m.Favicon) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Matcher) certIssuerMatch(certificate *Certificate) bool {
+	if certificate == nil {
+		return false
+	}
+	return strAndSliceMatch(&certificate.Issuer, m.CertIssuer)
 }
 
-func (m *Matcher) cookiesMatch(cookie *string) bool {
-	return strAndMapMatch(cookie, m.Cookies)
+func (m *Matcher) certMatch(certificate *Certificate) bool {
+	if certificate == nil {
+		return false
+	}
+	fields := certificate.fields()
+	return sliceAndSliceMatch(&fields, m.Cert)
 }
 
-func (m *Matcher) javascriptMatch(js *[]string) bool {
-	return sliceAndMapMatch(js, m.JavaScript)
+func (m *Matcher) dnsMatch(records map[string][]string) bool {
+	for recordType, matches := range m.Dns {
+		values := records[strings.ToUpper(recordType)]
+		if sliceAndSliceMatch(&values, matches) {
+			return true
+		}
+	}
+	return false
+}
+
+// siteFilesMatch returns the names of the site files matching their rules
+func (m *Matcher) siteFilesMatch(siteFiles *SiteFiles) []string {
+	if siteFiles == nil {
+		return nil
+	}
+
+	var files []string
+	for file, matches := range m.SiteFiles {
+		content, found := siteFiles.contents[file]
+		if found && strAndSliceMatch(&content, matches) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func (m *Matcher) headersMatch(responses []RedirectHop) bool {
+	for _, response := range responses {
+		for key, match := range m.Headers {
+			if match == nil {
+				continue
+			}
+
+			for _, value := range response.Headers[http.CanonicalHeaderKey(key)] {
+				if match.MatchString(value) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (m *Matcher) cookiesMatch(cookies *map[string]string) bool {
+	return mapAndMapMatch(cookies, m.Cookies)
+}
+
+// javascriptMatch checks the globals defined once the page's scripts have run, returning the version captured by the
+// first group of the matching rule, if any
+func (m *Matcher) javascriptMatch(globals map[string]string) (bool, string) {
+	for global, match := range m.JavaScript {
+		value, defined := globals[global]
+		if !defined || match == nil {
+			continue
+		}
+
+		if groups := match.FindStringSubmatch(value); groups != nil {
+			if len(groups) > 1 {
+				return true, groups[1]
+			}
+			return true, ""
+		}
+	}
+	return false, ""
 }
 
 func (m *Matcher) scriptMatch(script *[]string) bool {
 	return sliceAndSliceMatch(script, m.Script)
 }
 
+func (m *Matcher) scriptContentMatch(scripts *[]string) bool {
+	return sliceAndSliceMatch(scripts, m.ScriptContent)
+}
+
+func (m *Matcher) cssMatch(css *[]string) bool {
+	return sliceAndSliceMatch(css, m.Css)
+}
+
+func (m *Matcher) domMatch(doc *goquery.Document) bool {
+	if doc == nil {
+		return false
+	}
+
+	for _, rule := range m.Dom {
+		if rule.matches(doc) {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Matcher) metaMatch(meta *map[string]string) bool {
 	return mapAndMapMatch(meta, m.Meta)
 }
 
-func (m *Matcher) Evaluate(tech string, matchResult *MatchResult) {
+func (m *Matcher) Evaluate(tech string, data *ResponseData, matchResult *MatchResult) {
 	var matchTypes []string
-	if contentMatch := m.contentMatch(m.HtmlExtractions.RawHtmlBody); contentMatch {
+	if contentMatch := m.contentMatch(data.HtmlExtractions.RawHtmlBody); contentMatch {
 		matchTypes = append(matchTypes, "htmlContent")
-		matchResult.TechnologyMatches[tech] = matchTypes
-		matchResult.TechFound = append(matchResult.TechFound, tech)
 	}
 
-	if scriptMatch := m.scriptMatch(&m.HtmlExtractions.ScriptTags); scriptMatch {
+	if urlMatch := m.urlMatch(data.urls()); urlMatch {
+		matchTypes = append(matchTypes, "url")
+	}
+
+	if faviconMatch := m.faviconMatch(data.Favicons); faviconMatch {
+		matchTypes = append(matchTypes, "favicon")
+	}
+
+	if certIssuerMatch := m.certIssuerMatch(data.Certificate); certIssuerMatch {
+		matchTypes = append(matchTypes, "certIssuer")
+	}
+
+	if certMatch := m.certMatch(data.Certificate); certMatch {
+		matchTypes = append(matchTypes, "cert")
+	}
+
+	if dnsMatch := m.dnsMatch(data.Dns); dnsMatch {
+		matchTypes = append(matchTypes, "dns")
+	}
+
+	matchTypes = append(matchTypes, m.siteFilesMatch(data.SiteFiles)...)
+
+	if textMatch := m.textMatch(&data.HtmlExtractions.VisibleText); textMatch {
+		matchTypes = append(matchTypes, "text")
+	}
+
+	if scriptMatch := m.scriptMatch(&data.HtmlExtractions.ScriptTags); scriptMatch {
 		matchTypes = append(matchTypes, "scriptTag")
-		matchResult.TechnologyMatches[tech] = matchTypes
-		matchResult.TechFound = append(matchResult.TechFound, tech)
 	}
 
-	if metaMatch := m.metaMatch(&m.HtmlExtractions.MetaTags); metaMatch {
+	if scriptContentMatch := m.scriptContentMatch(&data.Scripts); scriptContentMatch {
+		matchTypes = append(matchTypes, "scriptContent")
+	}
+
+	if cssMatch := m.cssMatch(&data.Css); cssMatch {
+		matchTypes = append(matchTypes, "css")
+	}
+
+	if domMatch := m.domMatch(data.Document); domMatch {
+		matchTypes = append(matchTypes, "dom")
+	}
+
+	if metaMatch := m.metaMatch(&data.HtmlExtractions.MetaTags); metaMatch {
 		matchTypes = append(matchTypes, "metaTag")
-		matchResult.TechnologyMatches[tech] = matchTypes
-		matchResult.TechFound = append(matchResult.TechFound, tech)
 	}
 
-	if jsMatch := m.javascriptMatch(&m.HtmlExtractions.InlineJavaScript); jsMatch {
+	jsMatch, version := m.javascriptMatch(data.JavaScriptGlobals)
+	if jsMatch {
 		matchTypes = append(matchTypes, "javascriptContent")
-		matchResult.TechnologyMatches[tech] = matchTypes
-		matchResult.TechFound = append(matchResult.TechFound, tech)
 	}
+
+	// Headers and cookies are checked on every redirect hop, as well as the final response
+	if headerMatch := m.headersMatch(data.Responses); headerMatch {
+		matchTypes = append(matchTypes, "header")
+	}
+
+	cookies := data.cookies()
+	if cookieMatch := m.cookiesMatch(&cookies); cookieMatch {
+		matchTypes = append(matchTypes, "cookie")
+	}
+
+	// A result can be evaluated against several responses, so merge with any previous matches for the technology
+	matchResult.addMatches(tech, matchTypes)
+
+	matchResult.setVersion(tech, version)
 }
 
-func strAndMapMatch(matchStrPtr *string, values map[string]*regexp.Regexp) bool {
-	matchStr := *matchStrPtr
-	for key, match := range values {
-		if match == nil {
-			continue
+// addMatches adds the types of matches found for a technology, merging them with any previous matches
+func (mr *MatchResult) addMatches(tech string, matchTypes []string) {
+	if len(matchTypes) == 0 {
+		return
+	}
+
+	previousTypes, found := mr.TechnologyMatches[tech]
+	if !found {
+		mr.TechFound = append(mr.TechFound, tech)
+	}
+	for _, matchType := range matchTypes {
+		if !containsString(previousTypes, matchType) {
+			previousTypes = append(previousTypes, matchType)
 		}
+	}
+	mr.TechnologyMatches[tech] = previousTypes
+}
 
-		if strings.ToLower(matchStr) == strings.ToLower(key) && match.MatchString(matchStr) {
-			return true
+// AddInfo adds the metadata of the rules of technologies found
+func (mr *MatchResult) AddInfo(apps map[string]AppMatch) {
+	for _, tech := range mr.TechFound {
+		app, ok := apps[tech]
+		if !ok {
+			continue
+		}
+		if info := app.Info(); info != nil {
+			if mr.TechnologyInfo == nil {
+				mr.TechnologyInfo = map[string]*TechnologyInfo{}
+			}
+			mr.TechnologyInfo[tech] = info
 		}
 	}
-	return false
+}
+
+func (mr *MatchResult) setVersion(tech string, version string) {
+	if version == "" {
+		return
+	}
+
+	if mr.Versions == nil {
+		mr.Versions = map[string]string{}
+	}
+	mr.Versions[tech] = version
 }
 
 func strAndSliceMatch(matchStrPtr *string, values []*regexp.Regexp) bool {
@@ -123,22 +376,6 @@ func sliceAndSliceMatch(matchSlicePtr *[]string, values []*regexp.Regexp) bool {
 	return false
 }
 
-func sliceAndMapMatch(matchSlicePtr *[]string, values map[string]*regexp.Regexp) bool {
-	matchSlice := *matchSlicePtr
-	for key, match := range values {
-		if match == nil {
-			continue
-		}
-
-		for _, val := range matchSlice {
-			if strings.ToLower(val) == strings.ToLower(key) && match.MatchString(val) {
-				return true
-			}
-		}
-	}
-	return false
-}
-
 func mapAndMapMatch(matchMapPtr *map[string]string, values map[string]*regexp.Regexp) bool {
 	matchMap := *matchMapPtr
 	for key, match := range values {
@@ -0,0 +1,165 @@
+package matcher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Probe is a request sent to a specific endpoint of a host (i.e. /actuator/health), with the rules its response must
+// match to identify a technology. Every rule given must match, and a probe without rules matches any 2xx response
+type Probe struct {
+	Method  string
+	Path    string
+	Headers map[string]string
+	// Rules for the status code, headers and body (any of the regex values) of the response
+	Status          *regexp.Regexp
+	ResponseHeaders map[string]*regexp.Regexp
+	Body            []*regexp.Regexp
+}
+
+// ProbeResponse is the response received for a probe
+type ProbeResponse struct {
+	StatusCode int
+	Headers    http.Header
+	Body       string
+}
+
+// ParseProbes parses probes, which are either an object or a list of objects with the request to send (method, path
+// and headers) and the rules for its response (status, responseHeaders and body)
+func ParseProbes(value interface{}) ([]Probe, error) {
+	var values []interface{}
+	if list, ok := value.([]interface{}); ok {
+		values = list
+	} else {
+		values = []interface{}{value}
+	}
+
+	var probes []Probe
+	for _, v := range values {
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%v is not a valid probe. It must be an object", v))
+		}
+		probe, err := newProbe(fields)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
+
+func newProbe(fields map[string]interface{}) (Probe, error) {
+	probe := Probe{Method: "GET", Headers: map[string]string{}}
+	var err error
+
+	for field, value := range fields {
+		switch field {
+		case "method":
+			probe.Method = strings.ToUpper(fmt.Sprintf("%v", value))
+		case "path":
+			probe.Path = fmt.Sprintf("%v", value)
+		case "headers":
+			headers, ok := value.(map[string]interface{})
+			if !ok {
+				return probe, errors.New("probe headers must be an object")
+			}
+			for name, v := range headers {
+				probe.Headers[name] = fmt.Sprintf("%v", v)
+			}
+		case "status":
+			if probe.Status, err = regexp.Compile(fmt.Sprintf("%v", value)); err != nil {
+				return probe, err
+			}
+		case "responseHeaders":
+			headers, ok := value.(map[string]interface{})
+			if !ok {
+				return probe, errors.New("probe responseHeaders must be an object")
+			}
+			probe.ResponseHeaders = map[string]*regexp.Regexp{}
+			for name, v := range headers {
+				if probe.ResponseHeaders[name], err = regexp.Compile(fmt.Sprintf("%v", v)); err != nil {
+					return probe, err
+				}
+			}
+		case "body":
+			bodies, ok := value.([]interface{})
+			if !ok {
+				bodies = []interface{}{value}
+			}
+			for _, v := range bodies {
+				re, err := regexp.Compile(fmt.Sprintf("%v", v))
+				if err != nil {
+					return probe, err
+				}
+				probe.Body = append(probe.Body, re)
+			}
+		default:
+			return probe, errors.New(fmt.Sprintf("%v is not a valid probe field. Available fields are: method, path, headers, status, responseHeaders, body", field))
+		}
+	}
+
+	if !strings.HasPrefix(probe.Path, "/") {
+		return probe, errors.New(fmt.Sprintf("probe path %v must start with /", probe.Path))
+	}
+	return probe, nil
+}
+
+// Key identifies the request sent by a probe, so probes sending the same request share its response
+func (p *Probe) Key() string {
+	var headers []string
+	for name, value := range p.Headers {
+		headers = append(headers, strings.ToLower(name)+": "+value)
+	}
+	sort.Strings(headers)
+	return p.Method + " " + p.Path + " " + strings.Join(headers, "; ")
+}
+
+func (p *Probe) matches(resp *ProbeResponse) bool {
+	if resp == nil {
+		return false
+	}
+
+	if p.Status == nil && p.ResponseHeaders == nil && p.Body == nil {
+		return resp.StatusCode >= 200 && resp.StatusCode <= 299
+	}
+
+	if p.Status != nil && !p.Status.MatchString(strconv.Itoa(resp.StatusCode)) {
+		return false
+	}
+
+	for name, match := range p.ResponseHeaders {
+		found := false
+		for _, value := range resp.Headers[http.CanonicalHeaderKey(name)] {
+			if match.MatchString(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if p.Body != nil && !strAndSliceMatch(&resp.Body, p.Body) {
+		return false
+	}
+	return true
+}
+
+// EvaluateProbes sends the technology's probes through the function given, and adds a match if any probe's response
+// matches its rules
+func (m *Matcher) EvaluateProbes(tech string, send func(probe *Probe) *ProbeResponse, matchResult *MatchResult) {
+	for i := range m.Probes {
+		probe := &m.Probes[i]
+		if probe.matches(send(probe)) {
+			matchResult.addMatches(tech, []string{"probe"})
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package matcher
+
+import (
+	"net/http"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// RedirectHop is a response received while requesting a URL, either a redirect or the final response
+type RedirectHop struct {
+	Url        string      `json:"url"`
+	StatusCode int         `json:"status"`
+	Headers    http.Header `json:"headers"`
+}
+
+// ResponseData is the data gathered from requesting a URL that matchers are evaluated against
+type ResponseData struct {
+	HtmlExtractions HtmlExtractions
+	Document        *goquery.Document
+	// The URL requested, which Responses start from
+	RequestUrl string
+	// Every redirect followed, then the final response
+	Responses []RedirectHop
+	// Contents of the external scripts fetched from the page
+	Scripts []string
+	// Contents of the stylesheets fetched from the page, and of its inline style tags
+	Css []string
+	// The TLS certificate presented by the host of the final response, if any
+	Certificate *Certificate
+	// DNS records of the host, by record type
+	Dns map[string][]string
+	// Files found on the host, i.e. robots.txt
+	SiteFiles *SiteFiles
+	// Icons fetched for the page
+	Favicons []Favicon
+	// Values of the globals checked by JavaScript rules, once the page's scripts have run
+	JavaScriptGlobals map[string]string
+}
+
+// urls returns the URL requested, and the URL of every response received for it
+func (rd *ResponseData) urls() []string {
+	urls := []string{rd.RequestUrl}
+	for _, hop := range rd.Responses {
+		urls = append(urls, hop.Url)
+	}
+	return urls
+}
+
+func (rd *ResponseData) cookies() map[string]string {
+	cookies := map[string]string{}
+	for _, hop := range rd.Responses {
+		response := http.Response{Header: hop.Headers}
+		for _, cookie := range response.Cookies() {
+			cookies[cookie.Name] = cookie.Value
+		}
+	}
+	return cookies
+}
@@ -0,0 +1,149 @@
+package matcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+)
+
+// Names of the site files fetched for each host, as used by rules matching their content
+const (
+	RobotsFile        = "robots"
+	SecurityFile      = "security"
+	HumansFile        = "humans"
+	ManifestFile      = "manifest"
+	BrowserConfigFile = "browserconfig"
+)
+
+// SiteFiles holds what was found in the well-known files of a host (robots.txt, security.txt, humans.txt,
+// manifest.json and browserconfig.xml)
+type SiteFiles struct {
+	// Paths allowed or disallowed in robots.txt, and the sitemaps it lists
+	Paths    []string `json:"paths,omitempty"`
+	Sitemaps []string `json:"sitemaps,omitempty"`
+	// Fields of security.txt (i.e. contact, policy), and the content of humans.txt
+	Security map[string][]string `json:"security,omitempty"`
+	Humans   string              `json:"humans,omitempty"`
+	// Top level text fields of the web app manifest (i.e. name, start_url), and the settings in browserconfig.xml
+	Manifest      map[string]string `json:"manifest,omitempty"`
+	BrowserConfig map[string]string `json:"browserconfig,omitempty"`
+	// Content of each file found, by file name
+	contents map[string]string
+}
+
+func NewSiteFiles() *SiteFiles {
+	return &SiteFiles{contents: map[string]string{}}
+}
+
+// Add parses the content of a file found on the host
+func (sf *SiteFiles) Add(file string, content string) {
+	sf.contents[file] = content
+
+	switch file {
+	case RobotsFile:
+		sf.parseRobots(content)
+	case SecurityFile:
+		sf.parseSecurity(content)
+	case HumansFile:
+		sf.Humans = strings.TrimSpace(content)
+	case ManifestFile:
+		sf.parseManifest(content)
+	case BrowserConfigFile:
+		sf.parseBrowserConfig(content)
+	}
+}
+
+// Found reports whether any file was found on the host
+func (sf *SiteFiles) Found() bool {
+	return len(sf.contents) > 0
+}
+
+func (sf *SiteFiles) parseRobots(content string) {
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		field, value := splitField(scanner.Text())
+		switch field {
+		case "allow", "disallow":
+			if value != "" && value != "/" && !seen[value] {
+				seen[value] = true
+				sf.Paths = append(sf.Paths, value)
+			}
+		case "sitemap":
+			if value != "" {
+				sf.Sitemaps = append(sf.Sitemaps, value)
+			}
+		}
+	}
+}
+
+func (sf *SiteFiles) parseSecurity(content string) {
+	sf.Security = map[string][]string{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		if field, value := splitField(scanner.Text()); field != "" && value != "" {
+			sf.Security[field] = append(sf.Security[field], value)
+		}
+	}
+}
+
+func (sf *SiteFiles) parseManifest(content string) {
+	var manifest map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &manifest); err != nil {
+		return
+	}
+
+	sf.Manifest = map[string]string{}
+	for key, value := range manifest {
+		if str, ok := value.(string); ok {
+			sf.Manifest[key] = str
+		}
+	}
+}
+
+// parseBrowserConfig reads the settings of browserconfig.xml, i.e. <TileColor>#da532c</TileColor> or
+// <square150x150logo src="/mstile-150x150.png"/>
+func (sf *SiteFiles) parseBrowserConfig(content string) {
+	sf.BrowserConfig = map[string]string{}
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	var current string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "src" {
+					sf.BrowserConfig[current] = attr.Value
+				}
+			}
+		case xml.CharData:
+			if value := strings.TrimSpace(string(t)); value != "" && current != "" {
+				sf.BrowserConfig[current] = value
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+}
+
+// splitField splits a "Field: value" line, ignoring comments. The field is returned in lowercase
+func splitField(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	if i := strings.Index(line, " #"); i >= 0 {
+		line = line[:i]
+	}
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) < 2 {
+		return "", ""
+	}
+	return strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// BloomFilter is a fixed size, probabilistic set used to deduplicate URLs without
+// holding every URL seen in memory. Lookups may return false positives (a new URL
+// reported as already seen), but never false negatives.
+type BloomFilter struct {
+	bits     []uint64
+	size     uint64
+	hashes   uint64
+	inserted uint64
+	mu       sync.Mutex
+}
+
+func NewBloomFilter(capacity int, falsePositiveRate float64) *BloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.0001
+	}
+
+	// Optimal number of bits and hash functions for the expected capacity and false positive rate
+	size := uint64(math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(math.Max(1, math.Round(float64(size)/float64(capacity)*math.Ln2)))
+
+	return &BloomFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// TestAndAdd adds the value to the filter, returning true if it was (probably) already present
+func (b *BloomFilter) TestAndAdd(value string) bool {
+	h1, h2 := bloomHashes(value)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	present := true
+	for i := uint64(0); i < b.hashes; i++ {
+		position := (h1 + i*h2) % b.size
+		if b.bits[position/64]&(1<<(position%64)) == 0 {
+			present = false
+			b.bits[position/64] |= 1 << (position % 64)
+		}
+	}
+
+	if !present {
+		b.inserted += 1
+	}
+	return present
+}
+
+// SizeInBytes returns the memory used by the filter's bit array
+func (b *BloomFilter) SizeInBytes() int {
+	return len(b.bits) * 8
+}
+
+// Inserted returns the number of unique values added to the filter
+func (b *BloomFilter) Inserted() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inserted
+}
+
+// EstimatedFalsePositiveRate returns the probability of a new value being reported as seen,
+// given the number of values inserted so far
+func (b *BloomFilter) EstimatedFalsePositiveRate() float64 {
+	inserted := float64(b.Inserted())
+	return math.Pow(1-math.Exp(-float64(b.hashes)*inserted/float64(b.size)), float64(b.hashes))
+}
+
+func bloomHashes(value string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	h1 := h.Sum64()
+
+	h = fnv.New64()
+	h.Write([]byte(value))
+	h2 := h.Sum64() | 1
+
+	return h1, h2
+}
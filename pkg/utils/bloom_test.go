@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	tests := []struct {
+		name              string
+		capacity          int
+		falsePositiveRate float64
+		// Number of URLs inserted, which can be more than the capacity
+		inserted int
+		// Bounds of the false positive rate seen testing URLs never inserted
+		minRate float64
+		maxRate float64
+	}{
+		{name: "default rate", capacity: 10000, falsePositiveRate: 0.0001, inserted: 10000, maxRate: 0.0005},
+		{name: "higher rate", capacity: 10000, falsePositiveRate: 0.01, inserted: 10000, maxRate: 0.02},
+		{name: "under capacity", capacity: 10000, falsePositiveRate: 0.01, inserted: 1000, maxRate: 0.001},
+		{name: "over capacity", capacity: 1000, falsePositiveRate: 0.01, inserted: 10000, minRate: 0.5, maxRate: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBloomFilter(tt.capacity, tt.falsePositiveRate)
+
+			// False positives while inserting are counted as duplicates, so only new values are counted as inserted
+			falsePositives := 0
+			for i := 0; i < tt.inserted; i++ {
+				if b.TestAndAdd(fmt.Sprintf("https://example.com/inserted/%v", i)) {
+					falsePositives++
+				}
+			}
+			if b.Inserted() != uint64(tt.inserted-falsePositives) {
+				t.Errorf("Inserted() = %v, want %v", b.Inserted(), tt.inserted-falsePositives)
+			}
+
+			// There are never false negatives
+			for i := 0; i < tt.inserted; i++ {
+				if !b.TestAndAdd(fmt.Sprintf("https://example.com/inserted/%v", i)) {
+					t.Fatalf("value %v inserted but not found", i)
+				}
+			}
+
+			tested := 100000
+			falsePositives = 0
+			for i := 0; i < tested; i++ {
+				if contains(b, fmt.Sprintf("https://example.com/new/%v", i)) {
+					falsePositives++
+				}
+			}
+
+			rate := float64(falsePositives) / float64(tested)
+			if rate < tt.minRate || rate > tt.maxRate {
+				t.Errorf("false positive rate = %v, want between %v and %v", rate, tt.minRate, tt.maxRate)
+			}
+			if estimate := b.EstimatedFalsePositiveRate(); estimate < tt.minRate || estimate > tt.maxRate {
+				t.Errorf("EstimatedFalsePositiveRate() = %v, want between %v and %v", estimate, tt.minRate, tt.maxRate)
+			}
+		})
+	}
+}
+
+// contains tests for a value without adding it, so the filter stays as it was
+func contains(b *BloomFilter, value string) bool {
+	h1, h2 := bloomHashes(value)
+	for i := uint64(0); i < b.hashes; i++ {
+		position := (h1 + i*h2) % b.size
+		if b.bits[position/64]&(1<<(position%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"path"
+	"strings"
+	"sync"
+)
+
+// Extensions of static files that aren't worth scanning as pages while crawling
+var staticExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".ico": true, ".webp": true, ".bmp": true,
+	".css": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true, ".otf": true,
+	".mp3": true, ".mp4": true, ".webm": true, ".avi": true, ".mov": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tar": true, ".exe": true, ".dmg": true,
+}
+
+// Crawler keeps track of the pages visited for each origin (scheme, host and port), so each page is only scanned
+// once and no more than the maximum pages are crawled per origin
+type Crawler struct {
+	maxPages int
+	pages    map[string]int
+	visited  map[string]bool
+	mu       sync.Mutex
+}
+
+func NewCrawler(maxPages int) *Crawler {
+	return &Crawler{
+		maxPages: maxPages,
+		pages:    make(map[string]int),
+		visited:  make(map[string]bool),
+	}
+}
+
+// MarkVisited records a page scanned from input, so it isn't crawled again. It counts towards the origin's pages
+func (c *Crawler) MarkVisited(page string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.visited[page] {
+		c.visited[page] = true
+		c.pages[HostKeyFromString(page)] += 1
+	}
+}
+
+// Visit records a page found while crawling, returning false if it was already visited, looks like a static
+// file, or the origin's page limit is reached
+func (c *Crawler) Visit(page string) bool {
+	if staticExtensions[strings.ToLower(path.Ext(strings.SplitN(page, "?", 2)[0]))] {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	origin := HostKeyFromString(page)
+	if c.visited[page] || c.pages[origin] >= c.maxPages {
+		return false
+	}
+	c.visited[page] = true
+	c.pages[origin] += 1
+	return true
+}
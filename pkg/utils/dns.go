@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+// Record types looked up for each host. CNAME records are looked up for the host itself, the others for the host and
+// the domain it belongs to (i.e. example.com for www.example.com), where they are usually set
+var dnsRecordTypes = map[string]uint16{
+	"CNAME": dns.TypeCNAME,
+	"MX":    dns.TypeMX,
+	"TXT":   dns.TypeTXT,
+	"NS":    dns.TypeNS,
+	"SOA":   dns.TypeSOA,
+}
+
+// DnsResolver looks up the DNS records of hosts, caching them so each host is only looked up once. The records of the
+// domain a host belongs to are cached by domain, so they are shared by the domain's hosts, and kept until every host
+// using them is forgotten
+type DnsResolver struct {
+	server      string
+	client      *dns.Client
+	tcpClient   *dns.Client
+	hosts       map[string]*dnsRecords
+	domains     map[string]*dnsRecords
+	domainHosts map[string]map[string]bool
+	mu          sync.Mutex
+}
+
+type dnsRecords struct {
+	once    sync.Once
+	records map[string][]string
+}
+
+// NewDnsResolver creates a resolver sending queries to the server given (host:port), or the first nameserver in
+// /etc/resolv.conf if none is given
+func NewDnsResolver(server string, timeout time.Duration) *DnsResolver {
+	if server == "" {
+		server = "127.0.0.1:53"
+		if resolvConf, err := dns.ClientConfigFromFile("/etc/resolv.conf"); err == nil && len(resolvConf.Servers) > 0 {
+			server = net.JoinHostPort(resolvConf.Servers[0], resolvConf.Port)
+		}
+	}
+
+	return &DnsResolver{
+		server:      server,
+		client:      &dns.Client{Timeout: timeout},
+		tcpClient:   &dns.Client{Net: "tcp", Timeout: timeout},
+		hosts:       make(map[string]*dnsRecords),
+		domains:     make(map[string]*dnsRecords),
+		domainHosts: make(map[string]map[string]bool),
+	}
+}
+
+// Lookup returns the records of a host by record type (i.e. MX), with names stripped of their trailing dot. IPs have
+// no records
+func (dr *DnsResolver) Lookup(host string, conf *config.Config) map[string][]string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+
+	domain := registrableDomain(host)
+
+	dr.mu.Lock()
+	hostEntry := cachedRecords(dr.hosts, host)
+	var domainEntry *dnsRecords
+	if domain != host {
+		domainEntry = cachedRecords(dr.domains, domain)
+		if dr.domainHosts[domain] == nil {
+			dr.domainHosts[domain] = map[string]bool{}
+		}
+		dr.domainHosts[domain][host] = true
+	}
+	dr.mu.Unlock()
+
+	hostEntry.once.Do(func() {
+		hostEntry.records = dr.lookupAll(host, true, conf)
+	})
+	if domainEntry == nil {
+		return hostEntry.records
+	}
+
+	domainEntry.once.Do(func() {
+		domainEntry.records = dr.lookupAll(domain, false, conf)
+	})
+	return mergeRecords(hostEntry.records, domainEntry.records)
+}
+
+// Forget drops the cached records of a host, and those of its domain once no other host is using them
+func (dr *DnsResolver) Forget(host string) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	domain := registrableDomain(host)
+
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+
+	delete(dr.hosts, host)
+	if hosts, ok := dr.domainHosts[domain]; ok {
+		delete(hosts, host)
+		if len(hosts) == 0 {
+			delete(dr.domainHosts, domain)
+			delete(dr.domains, domain)
+		}
+	}
+}
+
+func cachedRecords(entries map[string]*dnsRecords, name string) *dnsRecords {
+	entry, ok := entries[name]
+	if !ok {
+		entry = &dnsRecords{}
+		entries[name] = entry
+	}
+	return entry
+}
+
+// registrableDomain returns the domain a host belongs to (i.e. example.com for www.example.com)
+func registrableDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// lookupAll looks up every record type of a name. CNAME records are only looked up for hosts, not for their domain
+func (dr *DnsResolver) lookupAll(name string, cname bool, conf *config.Config) map[string][]string {
+	records := map[string][]string{}
+	for recordType, qtype := range dnsRecordTypes {
+		if qtype == dns.TypeCNAME && !cname {
+			continue
+		}
+
+		values, err := dr.query(name, qtype)
+		if err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error looking up %v records of %v: %v\n", recordType, name, err)
+			}
+			continue
+		}
+		if len(values) > 0 {
+			records[recordType] = values
+		}
+	}
+	return records
+}
+
+// mergeRecords combines the records of a host with those of its domain, without duplicates
+func mergeRecords(hostRecords map[string][]string, domainRecords map[string][]string) map[string][]string {
+	records := map[string][]string{}
+	seen := map[string]bool{}
+	for _, source := range []map[string][]string{hostRecords, domainRecords} {
+		for recordType, values := range source {
+			for _, value := range values {
+				if !seen[recordType+" "+value] {
+					seen[recordType+" "+value] = true
+					records[recordType] = append(records[recordType], value)
+				}
+			}
+		}
+	}
+	return records
+}
+
+func (dr *DnsResolver) query(name string, qtype uint16) ([]string, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.RecursionDesired = true
+	// Large answers (i.e. domains with many TXT records) don't fit in a plain UDP response, so advertise a larger
+	// buffer, and retry over TCP if the answer is still truncated
+	msg.SetEdns0(4096, false)
+
+	resp, _, err := dr.client.Exchange(msg, dr.server)
+	if err == nil && resp.Truncated {
+		resp, _, err = dr.tcpClient.Exchange(msg, dr.server)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Answers can include records of other types, i.e. the CNAMEs followed to get to the records requested
+	var values []string
+	for _, answer := range resp.Answer {
+		if answer.Header().Rrtype != qtype {
+			continue
+		}
+
+		switch record := answer.(type) {
+		case *dns.CNAME:
+			values = append(values, strings.TrimSuffix(record.Target, "."))
+		case *dns.MX:
+			values = append(values, strings.TrimSuffix(record.Mx, "."))
+		case *dns.TXT:
+			values = append(values, strings.Join(record.Txt, ""))
+		case *dns.NS:
+			values = append(values, strings.TrimSuffix(record.Ns, "."))
+		case *dns.SOA:
+			values = append(values, strings.TrimSuffix(record.Ns, ".")+" "+strings.TrimSuffix(record.Mbox, "."))
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+// startDnsServer serves the records given (by name and record type) over UDP and TCP on the same port, returning its
+// address and a function to shut it down. Each name queried is passed to queried, if given
+func startDnsServer(t *testing.T, records map[string]map[uint16][]dns.RR, queried func(name string)) (string, func()) {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+		question := r.Question[0]
+		if queried != nil {
+			queried(question.Name)
+		}
+		msg.Answer = records[question.Name][question.Qtype]
+
+		// Truncate answers too large for UDP, as a server would
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+			size := dns.MinMsgSize
+			if opt := r.IsEdns0(); opt != nil {
+				size = int(opt.UDPSize())
+			}
+			msg.Truncate(size)
+		}
+		w.WriteMsg(msg)
+	})
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udpServer := &dns.Server{PacketConn: udp, Handler: handler}
+	tcpServer := &dns.Server{Listener: tcp, Handler: handler}
+	go udpServer.ActivateAndServe()
+	go tcpServer.ActivateAndServe()
+	shutdown := func() {
+		udpServer.Shutdown()
+		tcpServer.Shutdown()
+	}
+	return udp.LocalAddr().String(), shutdown
+}
+
+func txtRecords(name string, count int, length int) []dns.RR {
+	var records []dns.RR
+	for i := 0; i < count; i++ {
+		value := fmt.Sprintf("%03d-", i)
+		for len(value) < length {
+			value += "x"
+		}
+		records = append(records, &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{value},
+		})
+	}
+	return records
+}
+
+func TestDnsResolverLookup(t *testing.T) {
+	mx := func(name string, host string) dns.RR {
+		return &dns.MX{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 60}, Mx: host}
+	}
+
+	// 40 TXT records of 200 bytes don't fit in 4096 bytes, so they are only answered in full over TCP
+	largeTxt := txtRecords("example.com.", 40, 200)
+	server, shutdown := startDnsServer(t, map[string]map[uint16][]dns.RR{
+		"example.com.": {
+			dns.TypeTXT: largeTxt,
+			dns.TypeMX:  {mx("example.com.", "aspmx.l.google.com.")},
+		},
+		"mail.example.com.": {
+			dns.TypeMX: {mx("mail.example.com.", "mx.sendgrid.net."), mx("mail.example.com.", "aspmx.l.google.com.")},
+		},
+	}, nil)
+	defer shutdown()
+
+	tests := []struct {
+		name       string
+		host       string
+		recordType string
+		want       int
+		values     []string
+	}{
+		{name: "truncated answer retried over TCP", host: "example.com", recordType: "TXT", want: 40},
+		{name: "domain records", host: "www.example.com", recordType: "MX", values: []string{"aspmx.l.google.com"}},
+		{name: "host and domain records merged", host: "mail.example.com", recordType: "MX", values: []string{"aspmx.l.google.com", "mx.sendgrid.net"}},
+		{name: "IPs have no records", host: "127.0.0.1", recordType: "TXT", want: 0},
+	}
+
+	conf := &config.Config{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewDnsResolver(server, 2*time.Second)
+			got := resolver.Lookup(tt.host, conf)[tt.recordType]
+			if tt.values != nil {
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, tt.values) {
+					t.Errorf("Lookup(%v)[%v] = %v, want %v", tt.host, tt.recordType, got, tt.values)
+				}
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("Lookup(%v)[%v] returned %v records, want %v", tt.host, tt.recordType, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestDnsResolverCache(t *testing.T) {
+	var mu sync.Mutex
+	queries := map[string]int{}
+	server, shutdown := startDnsServer(t, map[string]map[uint16][]dns.RR{}, func(name string) {
+		mu.Lock()
+		queries[name] += 1
+		mu.Unlock()
+	})
+	defer shutdown()
+
+	resolver := NewDnsResolver(server, 2*time.Second)
+	conf := &config.Config{}
+	// CNAME, MX, TXT, NS and SOA are looked up for hosts, and all but CNAME for domains
+	hostQueries, domainQueries := len(dnsRecordTypes), len(dnsRecordTypes)-1
+
+	tests := []struct {
+		name   string
+		lookup []string
+		forget []string
+		// Queries sent for each name so far
+		want map[string]int
+	}{
+		{
+			name:   "domain looked up once for its hosts",
+			lookup: []string{"a.example.com", "b.example.com", "a.example.com"},
+			want:   map[string]int{"a.example.com.": hostQueries, "b.example.com.": hostQueries, "example.com.": domainQueries},
+		},
+		{
+			name:   "domain kept while a host uses it",
+			forget: []string{"a.example.com"},
+			lookup: []string{"a.example.com", "b.example.com"},
+			want:   map[string]int{"a.example.com.": 2 * hostQueries, "b.example.com.": hostQueries, "example.com.": domainQueries},
+		},
+		{
+			name:   "domain dropped once every host is forgotten",
+			forget: []string{"a.example.com", "b.example.com"},
+			lookup: []string{"b.example.com"},
+			want:   map[string]int{"a.example.com.": 2 * hostQueries, "b.example.com.": 2 * hostQueries, "example.com.": 2 * domainQueries},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, host := range tt.forget {
+				resolver.Forget(host)
+			}
+			for _, host := range tt.lookup {
+				resolver.Lookup(host, conf)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(queries, tt.want) {
+				t.Errorf("queries = %v, want %v", queries, tt.want)
+			}
+		})
+	}
+
+	resolver.Forget("b.example.com")
+	if len(resolver.hosts) != 0 || len(resolver.domains) != 0 || len(resolver.domainHosts) != 0 {
+		t.Errorf("records left once every host is forgotten: %v hosts, %v domains", len(resolver.hosts), len(resolver.domains))
+	}
+}
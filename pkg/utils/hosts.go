@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// HostKey returns the scheme, host and port of a URL (i.e. https://example.com:443), used to group URLs by host
+func HostKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	return strings.ToLower(u.Scheme) + "://" + net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// HostKeyFromString is the same as HostKey, but for an unparsed URL. The URL is returned unchanged if it can't be parsed
+func HostKeyFromString(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return HostKey(u)
+}
+
+func rootUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	root := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	return root.String()
+}
+
+type hostSampler struct {
+	mode    string
+	count   int
+	perHost map[string]int
+}
+
+func newHostSampler(mode string, count int) *hostSampler {
+	return &hostSampler{
+		mode:    mode,
+		count:   count,
+		perHost: make(map[string]int),
+	}
+}
+
+// allow reports whether the URL should be scanned. Root sampling is handled before deduplication, by
+// mapping each URL to its host's root
+func (s *hostSampler) allow(rawUrl string) bool {
+	if s.mode != "first" {
+		return true
+	}
+
+	key := HostKeyFromString(rawUrl)
+	if s.perHost[key] >= s.count {
+		return false
+	}
+	s.perHost[key] += 1
+	return true
+}
+
+// hostIndex records the host names each cache key belongs to, so a cache can drop every key of a host once it's done
+// with. A key can belong to several hosts (i.e. the host a task was scheduled for, and the host it was redirected to),
+// and is dropped when any of them is forgotten
+type hostIndex struct {
+	keys  map[string]map[string]bool
+	hosts map[string]map[string]bool
+}
+
+func newHostIndex() *hostIndex {
+	return &hostIndex{
+		keys:  make(map[string]map[string]bool),
+		hosts: make(map[string]map[string]bool),
+	}
+}
+
+func (hi *hostIndex) add(key string, hosts ...string) {
+	for _, host := range hosts {
+		if hi.keys[host] == nil {
+			hi.keys[host] = map[string]bool{}
+		}
+		hi.keys[host][key] = true
+		if hi.hosts[key] == nil {
+			hi.hosts[key] = map[string]bool{}
+		}
+		hi.hosts[key][host] = true
+	}
+}
+
+// forget removes a host and its keys from the index, returning the keys removed
+func (hi *hostIndex) forget(host string) []string {
+	var keys []string
+	for key := range hi.keys[host] {
+		keys = append(keys, key)
+		for other := range hi.hosts[key] {
+			delete(hi.keys[other], key)
+			if len(hi.keys[other]) == 0 {
+				delete(hi.keys, other)
+			}
+		}
+		delete(hi.hosts, key)
+	}
+	delete(hi.keys, host)
+	return keys
+}
@@ -2,16 +2,23 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/EDDYCJY/fake-useragent"
 	"github.com/PuerkitoBio/goquery"
 
 	"github.com/ameenmaali/whoareyou/pkg/config"
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
 )
 
 type Response struct {
@@ -20,9 +27,18 @@ type Response struct {
 	Headers       http.Header
 	ContentLength int
 	GoQueryDoc    *goquery.Document
+	FinalUrl      string
+	Redirects     []matcher.RedirectHop
+	// Leaf certificate presented for the final response, when it was received over TLS
+	Certificate *matcher.Certificate
 }
 
-func CreateClient(timeout int) *http.Client {
+type redirectsContextKey struct{}
+
+// noRedirectsContextKey marks requests whose redirects shouldn't be followed, regardless of the redirect policy
+type noRedirectsContextKey struct{}
+
+func CreateClient(timeout int, conf *config.Config) *http.Client {
 	transport := &http.Transport{
 		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
 		DisableKeepAlives: true,
@@ -33,18 +49,63 @@ func CreateClient(timeout int) *http.Client {
 	}
 
 	httpClient := &http.Client{
-		Transport: transport,
-		Timeout:   time.Duration(timeout+3) * time.Second,
+		Transport:     transport,
+		Timeout:       time.Duration(timeout+3) * time.Second,
+		CheckRedirect: redirectPolicy(conf),
+	}
+
+	// Send requests through the proxies provided, rotating between them for each request
+	if len(conf.Proxies) > 0 {
+		transport.Proxy = proxyFromContext
+		httpClient.Transport = &proxyTransport{
+			transport: transport,
+			pool:      NewProxyPool(conf.Proxies, conf.ProxyRotation, conf.ProxyCooldown),
+		}
 	}
 	return httpClient
 }
 
-func SendRequest(u string, config *config.Config) (Response, error) {
-	response := Response{}
+// RedirectAllowed returns whether the redirect policy configured allows following a redirect (HTTP or client side) from
+// the URL first requested to a destination
+func RedirectAllowed(from *url.URL, to *url.URL, conf *config.Config) bool {
+	switch conf.RedirectPolicy {
+	case "none":
+		return false
+	case "same-host":
+		return strings.EqualFold(from.Hostname(), to.Hostname())
+	}
+	return true
+}
+
+// redirectPolicy decides whether to follow each redirect based on the policy configured, and records the redirects
+// followed in the request's context. When a redirect isn't followed, the redirect response is used as the final one
+func redirectPolicy(conf *config.Config) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		switch {
+		case req.Context().Value(noRedirectsContextKey{}) != nil:
+			return http.ErrUseLastResponse
+		case !RedirectAllowed(via[0].URL, req.URL, conf):
+			return http.ErrUseLastResponse
+		case len(via) > conf.MaxRedirects:
+			return http.ErrUseLastResponse
+		}
+
+		if redirects, ok := req.Context().Value(redirectsContextKey{}).(*[]matcher.RedirectHop); ok && req.Response != nil {
+			*redirects = append(*redirects, matcher.RedirectHop{
+				Url:        req.Response.Request.URL.String(),
+				StatusCode: req.Response.StatusCode,
+				Headers:    req.Response.Header,
+			})
+		}
+		return nil
+	}
+}
 
-	request, err := http.NewRequest("GET", u, nil)
+// newRequest creates a request with the User-Agent, headers and cookies configured
+func newRequest(ctx context.Context, method string, u string, config *config.Config) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, u, nil)
 	if err != nil {
-		return response, err
+		return nil, err
 	}
 
 	request.Header.Add("User-Agent", browser.Random())
@@ -57,6 +118,90 @@ func SendRequest(u string, config *config.Config) (Response, error) {
 	// Add cookies passed in as arguments
 	request.Header.Add("Cookie", config.Cookies)
 
+	return request, nil
+}
+
+// FetchResource downloads a resource referenced by a page (i.e. a script or stylesheet), reading at most maxBytes
+// of the body. Only successful responses are returned, as error pages aren't the resource requested
+func FetchResource(u string, config *config.Config, maxBytes int64) ([]byte, error) {
+	request, err := newRequest(context.Background(), "GET", u, config)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := config.HttpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.New(fmt.Sprintf("%v returned status %v", u, resp.StatusCode))
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, errors.New(fmt.Sprintf("%v is larger than the maximum size of %v bytes", u, maxBytes))
+	}
+	return body, nil
+}
+
+// SendProbe sends a probe's request to the host of a page, without following redirects, and returns the response
+// whatever its status, reading at most maxBytes of the body. Paths that aren't valid (i.e. with a bad escape) are sent
+// as is
+func SendProbe(pageUrl string, probe *matcher.Probe, config *config.Config, maxBytes int64) (*matcher.ProbeResponse, error) {
+	target := ResolveUrl(pageUrl, probe.Path)
+	rawPath := ""
+	if target == "" {
+		target = ResolveUrl(pageUrl, "/")
+		rawPath = probe.Path
+	}
+
+	ctx := context.WithValue(context.Background(), noRedirectsContextKey{}, true)
+	request, err := newRequest(ctx, probe.Method, target, config)
+	if err != nil {
+		return nil, err
+	}
+	if rawPath != "" {
+		request.URL.Opaque = rawPath
+	}
+	for name, value := range probe.Headers {
+		request.Header.Set(name, value)
+	}
+
+	resp, err := config.HttpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return &matcher.ProbeResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
+		Body:       string(body),
+	}, nil
+}
+
+func SendRequest(u string, config *config.Config) (Response, error) {
+	response := Response{}
+
+	// Redirects followed are recorded by the client's redirect policy
+	var redirects []matcher.RedirectHop
+	ctx := context.WithValue(context.Background(), redirectsContextKey{}, &redirects)
+
+	request, err := newRequest(ctx, "GET", u, config)
+	if err != nil {
+		return response, err
+	}
+
 	resp, err := config.HttpClient.Do(request)
 
 	if err != nil {
@@ -86,6 +231,11 @@ func SendRequest(u string, config *config.Config) (Response, error) {
 	response.Headers = resp.Header
 	response.StatusCode = resp.StatusCode
 	response.ContentLength = int(resp.ContentLength)
+	response.FinalUrl = resp.Request.URL.String()
+	response.Redirects = redirects
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		response.Certificate = matcher.NewCertificate(resp.TLS.PeerCertificates[0])
+	}
 
 	return response, err
 }
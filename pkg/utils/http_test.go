@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+func TestRedirectAllowed(t *testing.T) {
+	tests := []struct {
+		policy string
+		to     string
+		want   bool
+	}{
+		{policy: "follow", to: "https://other.example.com/", want: true},
+		{policy: "none", to: "https://example.com/login"},
+		{policy: "same-host", to: "http://EXAMPLE.com:8080/login", want: true},
+		{policy: "same-host", to: "https://www.example.com/"},
+	}
+
+	from, _ := url.Parse("https://example.com/")
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.to, func(t *testing.T) {
+			to, _ := url.Parse(tt.to)
+			if got := RedirectAllowed(from, to, &config.Config{RedirectPolicy: tt.policy}); got != tt.want {
+				t.Errorf("RedirectAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+// Ports commonly serving HTTP(S), used when a port scan doesn't identify the service
+var webPorts = map[int][]string{
+	80: {"http"}, 81: {"http"}, 591: {"http"}, 2082: {"http"}, 2086: {"http"}, 3000: nil, 5000: nil,
+	8000: nil, 8008: nil, 8080: nil, 8081: nil, 8088: nil, 8888: nil, 9000: nil, 9080: nil,
+	443: {"https"}, 2083: {"https"}, 2087: {"https"}, 4443: {"https"}, 8443: {"https"}, 9443: {"https"},
+}
+
+type nmapRun struct {
+	Hosts []nmapHost `xml:"host"`
+}
+
+type nmapHost struct {
+	Addresses []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Hostnames []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"hostnames>hostname"`
+	Ports []struct {
+		Protocol string `xml:"protocol,attr"`
+		PortId   int    `xml:"portid,attr"`
+		State    struct {
+			State string `xml:"state,attr"`
+		} `xml:"state"`
+		Service struct {
+			Name   string `xml:"name,attr"`
+			Tunnel string `xml:"tunnel,attr"`
+		} `xml:"service"`
+	} `xml:"ports>port"`
+}
+
+type masscanRecord struct {
+	Ip    string `json:"ip"`
+	Ports []struct {
+		Port    int    `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Service struct {
+			Name string `json:"name"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// StreamTargets reads targets from stdin in the input format configured, and sends them (deduplicated and sampled)
+// to the channel as they are read
+func StreamTargets(conf *config.Config, targets chan<- Target) error {
+	defer close(targets)
+
+	// Deduplicate with a bloom filter so memory stays bounded regardless of input size
+	deduplicatedUrls := NewBloomFilter(conf.DedupeCapacity, conf.DedupeFalsePositiveRate)
+	if conf.DebugMode {
+		conf.Utils.PrintCyan(os.Stderr, "deduplication filter sized for %v URLs at a %v false positive rate (%.2f MB)\n",
+			conf.DedupeCapacity, conf.DedupeFalsePositiveRate, float64(deduplicatedUrls.SizeInBytes())/(1024*1024))
+	}
+
+	sampler := newHostSampler(conf.SampleMode, conf.SampleCount)
+
+	emit := func(target Target) {
+		// Only the root of each host is scanned in root sampling mode, so map the URLs to it before deduplicating
+		if sampler.mode == "root" {
+			for i, candidate := range target.Candidates {
+				target.Candidates[i] = rootUrl(candidate)
+			}
+		}
+
+		// URLs are deduplicated by their normalized form, but requested as they were given
+		key, err := NormalizeUrl(target.Candidates[0], conf)
+		if err != nil && conf.DebugMode {
+			conf.Utils.PrintRed(os.Stderr, "unable to normalize [%v]: %v\n", target.Candidates[0], err)
+		}
+
+		if deduplicatedUrls.TestAndAdd(key) {
+			return
+		}
+
+		if !sampler.allow(key) {
+			return
+		}
+
+		targets <- target
+	}
+
+	var err error
+	switch conf.InputFormat {
+	case "nmap-xml":
+		err = readNmapXml(os.Stdin, conf, emit)
+	case "masscan-json":
+		err = readMasscanJson(os.Stdin, conf, emit)
+	case "masscan-list":
+		err = readMasscanList(os.Stdin, conf, emit)
+	case "jsonl":
+		err = readJsonLines(os.Stdin, conf, emit)
+	default:
+		err = readPlain(os.Stdin, conf, emit)
+	}
+
+	if conf.DebugMode {
+		conf.Utils.PrintCyan(os.Stderr, "%v unique URLs read, estimated deduplication false positive rate: %.6f\n",
+			deduplicatedUrls.Inserted(), deduplicatedUrls.EstimatedFalsePositiveRate())
+		if deduplicatedUrls.Inserted() > uint64(conf.DedupeCapacity) {
+			conf.Utils.PrintYellow(os.Stderr, "more unique URLs than the deduplication capacity were read, some URLs may have been wrongly skipped. Consider raising -dedupe-capacity\n")
+		}
+	}
+
+	return err
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
+
+// readPlain reads a URL, host, IP or CIDR range per line
+func readPlain(r io.Reader, conf *config.Config, emit func(Target)) error {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+
+		// Only include properly formatted URLs, hosts and IPs
+		parsedTargets, err := parseTargets(input, conf)
+		if err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "input provided [%v] is not a properly formatted URL or host: %v\n", input, err)
+			}
+			continue
+		}
+
+		for _, target := range parsedTargets {
+			emit(target)
+		}
+	}
+	return scanner.Err()
+}
+
+// readNmapXml reads hosts from nmap's XML output (-oX) one at a time, so large scans aren't loaded into memory
+func readNmapXml(r io.Reader, conf *config.Config, emit func(Target)) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "host" {
+			continue
+		}
+
+		var host nmapHost
+		if err := decoder.DecodeElement(&host, &start); err != nil {
+			return err
+		}
+
+		var ip string
+		for _, address := range host.Addresses {
+			if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+				ip = address.Addr
+				break
+			}
+		}
+
+		// Prefer hostnames provided to nmap over reverse DNS names, as they are more likely to match virtual hosts
+		var hostnames []string
+		scanHost := ip
+		for _, hostname := range host.Hostnames {
+			hostnames = append(hostnames, hostname.Name)
+			if hostname.Type == "user" {
+				scanHost = hostname.Name
+			}
+		}
+		if scanHost == "" {
+			continue
+		}
+
+		for _, port := range host.Ports {
+			if port.State.State != "open" || port.Protocol != "tcp" {
+				continue
+			}
+
+			schemes, ok := serviceSchemes(port.Service.Name, port.Service.Tunnel, port.PortId, conf)
+			if !ok {
+				continue
+			}
+
+			emit(portTarget(scanHost, ip, port.PortId, schemes, hostnames, port.Service.Name))
+		}
+	}
+}
+
+// readMasscanJson reads masscan's JSON output (-oJ), which is a JSON array with a record per line
+func readMasscanJson(r io.Reader, conf *config.Config, emit func(Target)) error {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ",")
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var record masscanRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "unable to parse masscan record [%v]: %v\n", line, err)
+			}
+			continue
+		}
+
+		for _, port := range record.Ports {
+			if (port.Status != "" && port.Status != "open") || (port.Proto != "" && port.Proto != "tcp") {
+				continue
+			}
+
+			schemes, ok := serviceSchemes(port.Service.Name, "", port.Port, conf)
+			if !ok {
+				continue
+			}
+
+			emit(portTarget(record.Ip, record.Ip, port.Port, schemes, nil, port.Service.Name))
+		}
+	}
+	return scanner.Err()
+}
+
+// readMasscanList reads masscan's list output (-oL), with lines formatted as: open tcp 80 10.0.0.1 1591000000
+func readMasscanList(r io.Reader, conf *config.Config, emit func(Target)) error {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "open" || fields[1] != "tcp" {
+			continue
+		}
+
+		port, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+
+		schemes, ok := serviceSchemes("", "", port, conf)
+		if !ok {
+			continue
+		}
+
+		emit(portTarget(fields[3], fields[3], port, schemes, nil, ""))
+	}
+	return scanner.Err()
+}
+
+// readJsonLines reads a JSON object per line (i.e. from other recon tools), taking the URL or host from the configured
+// field path. The rest of the record is passed through as metadata, to keep results joined to the upstream data
+func readJsonLines(r io.Reader, conf *config.Config, emit func(Target)) error {
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "unable to parse JSON line [%v]: %v\n", line, err)
+			}
+			continue
+		}
+
+		input, ok := lookupJsonField(record, conf.JsonField)
+		if !ok {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "field %v not found in JSON line [%v]\n", conf.JsonField, line)
+			}
+			continue
+		}
+
+		parsedTargets, err := parseTargets(input, conf)
+		if err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "input provided [%v] is not a properly formatted URL or host: %v\n", input, err)
+			}
+			continue
+		}
+
+		for _, target := range parsedTargets {
+			target.Metadata = record
+			emit(target)
+		}
+	}
+	return scanner.Err()
+}
+
+// lookupJsonField returns the string value at a dot separated path (i.e. .request.endpoint). Numeric path parts
+// index into arrays
+func lookupJsonField(record map[string]interface{}, path string) (string, bool) {
+	var current interface{} = record
+	for _, part := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			current = value[part]
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(value) {
+				return "", false
+			}
+			current = value[index]
+		default:
+			return "", false
+		}
+	}
+
+	str, ok := current.(string)
+	if !ok || strings.TrimSpace(str) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(str), true
+}
+
+// serviceSchemes returns the schemes to try for an open port, and whether the port looks like it serves HTTP(S)
+// at all, based on the service name and tunnel identified by the port scanner, or common web ports
+func serviceSchemes(service string, tunnel string, port int, conf *config.Config) ([]string, bool) {
+	service = strings.ToLower(service)
+
+	if tunnel == "ssl" || service == "https" || strings.HasPrefix(service, "ssl/http") || strings.HasPrefix(service, "https-") {
+		return []string{"https"}, true
+	}
+	if strings.HasPrefix(service, "http") {
+		return conf.Schemes, true
+	}
+
+	schemes, ok := webPorts[port]
+	if !ok {
+		return nil, false
+	}
+	if schemes == nil {
+		schemes = conf.Schemes
+	}
+	return schemes, true
+}
+
+func portTarget(host string, ip string, port int, schemes []string, hostnames []string, service string) Target {
+	portStr := strconv.Itoa(port)
+	target := hostTargets(net.JoinHostPort(host, portStr), host, "", []string{portStr}, schemes)[0]
+
+	target.Metadata = map[string]interface{}{
+		"ip":   ip,
+		"port": port,
+	}
+	if len(hostnames) > 0 {
+		target.Metadata["hostnames"] = hostnames
+	}
+	if service != "" {
+		target.Metadata["service"] = service
+	}
+	return target
+}
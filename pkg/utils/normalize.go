@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+// NormalizeUrl applies the normalization options configured, so equivalent URLs are deduplicated
+func NormalizeUrl(rawUrl string, conf *config.Config) (string, error) {
+	if len(conf.Normalization) == 0 && len(conf.IgnoredParams) == 0 {
+		return rawUrl, nil
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl, err
+	}
+
+	host, port := u.Hostname(), u.Port()
+
+	if conf.Normalization["lowercase"] {
+		u.Scheme = strings.ToLower(u.Scheme)
+		host = strings.ToLower(host)
+	}
+
+	if conf.Normalization["idn"] {
+		asciiHost, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return rawUrl, err
+		}
+		host = asciiHost
+	}
+
+	if conf.Normalization["default-port"] && port == defaultPorts[strings.ToLower(u.Scheme)] {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	if conf.Normalization["fragment"] {
+		u.Fragment = ""
+	}
+
+	if conf.Normalization["drop-query"] {
+		u.RawQuery = ""
+		u.ForceQuery = false
+	} else if u.RawQuery != "" {
+		u.RawQuery = normalizeQuery(u.RawQuery, conf.IgnoredParams, conf.Normalization["sort-query"])
+	}
+
+	return u.String(), nil
+}
+
+func normalizeQuery(rawQuery string, ignoredParams []string, sortParams bool) string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+
+		name := param
+		if i := strings.Index(param, "="); i != -1 {
+			name = param[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+
+		if isIgnoredParam(name, ignoredParams) {
+			continue
+		}
+		params = append(params, param)
+	}
+
+	if sortParams {
+		sort.Strings(params)
+	}
+	return strings.Join(params, "&")
+}
+
+// isIgnoredParam checks a parameter name against the ignored list. A trailing * matches any parameter with the prefix
+func isIgnoredParam(name string, ignoredParams []string) bool {
+	for _, ignored := range ignoredParams {
+		if strings.HasSuffix(ignored, "*") && strings.HasPrefix(name, strings.TrimSuffix(ignored, "*")) {
+			return true
+		}
+		if name == ignored {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+func TestNormalizeUrl(t *testing.T) {
+	defaults := []string{"lowercase", "default-port", "fragment"}
+
+	tests := []struct {
+		name          string
+		url           string
+		normalization []string
+		ignoredParams []string
+		want          string
+	}{
+		{name: "none", url: "HTTPS://Example.COM:443/Path#top", want: "HTTPS://Example.COM:443/Path#top"},
+		{name: "defaults", url: "HTTPS://Example.COM:443/Path#top", normalization: defaults, want: "https://example.com/Path"},
+		{name: "path case kept", url: "http://example.com/Admin?Q=1", normalization: defaults, want: "http://example.com/Admin?Q=1"},
+		{name: "other ports kept", url: "https://example.com:8443/", normalization: defaults, want: "https://example.com:8443/"},
+		{name: "http default port", url: "http://example.com:80/", normalization: []string{"default-port"}, want: "http://example.com/"},
+		{name: "https port on http kept", url: "http://example.com:443/", normalization: []string{"default-port"}, want: "http://example.com:443/"},
+		{name: "ipv6", url: "http://[2001:DB8::1]:80/", normalization: defaults, want: "http://[2001:db8::1]/"},
+		{name: "ipv6 with port", url: "http://[2001:db8::1]:8080/", normalization: defaults, want: "http://[2001:db8::1]:8080/"},
+		{name: "idn", url: "https://bücher.example/", normalization: []string{"idn"}, want: "https://xn--bcher-kva.example/"},
+		{name: "sort query", url: "https://example.com/?b=2&a=1", normalization: []string{"sort-query"}, want: "https://example.com/?a=1&b=2"},
+		{name: "drop query", url: "https://example.com/?b=2&a=1", normalization: []string{"drop-query"}, want: "https://example.com/"},
+		{
+			name:          "ignored params",
+			url:           "https://example.com/?id=1&utm_source=x&utm_medium=y&fbclid=z",
+			ignoredParams: []string{"utm_*", "fbclid"},
+			want:          "https://example.com/?id=1",
+		},
+		{
+			name:          "ignored params only",
+			url:           "https://example.com/?utm_source=x",
+			ignoredParams: []string{"utm_*"},
+			want:          "https://example.com/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{Normalization: map[string]bool{}, IgnoredParams: tt.ignoredParams}
+			for _, normalization := range tt.normalization {
+				conf.Normalization[normalization] = true
+			}
+
+			got, err := NormalizeUrl(tt.url, conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeUrl(%v) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
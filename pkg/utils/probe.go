@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
+)
+
+// Maximum size of a probe response body to read
+const maxProbeBodySize = 1024 * 1024
+
+// ProbeCache sends each probe request once per host (scheme, host and port), and caches the response, so technologies
+// probing the same endpoint share a request. Responses are kept until Forget is called for the host name
+type ProbeCache struct {
+	responses map[string]*probeEntry
+	hosts     *hostIndex
+	mu        sync.Mutex
+}
+
+type probeEntry struct {
+	once     sync.Once
+	response *matcher.ProbeResponse
+}
+
+// NewErrorProbes creates the probes requesting error pages from a host: a random path that doesn't exist, and a path
+// with a bad escape that most servers reject as a bad request
+func NewErrorProbes() []matcher.Probe {
+	token := make([]byte, 8)
+	rand.Read(token)
+	notFound := "/whoareyou-" + hex.EncodeToString(token)
+
+	return []matcher.Probe{
+		{Method: "GET", Path: notFound},
+		{Method: "GET", Path: notFound + "/%zz"},
+	}
+}
+
+func NewProbeCache() *ProbeCache {
+	return &ProbeCache{
+		responses: make(map[string]*probeEntry),
+		hosts:     newHostIndex(),
+	}
+}
+
+// Get returns the response to a probe sent to a URL's host, sending it the first time. Nil is returned if the request
+// failed. The response is dropped once Forget is called for the URL's host name, or for the host name of the task
+// sending the probe (owner), which differs when the task was redirected to another host
+func (pc *ProbeCache) Get(owner string, u string, probe *matcher.Probe, conf *config.Config) *matcher.ProbeResponse {
+	key := HostKeyFromString(u) + " " + probe.Key()
+
+	pc.mu.Lock()
+	entry, ok := pc.responses[key]
+	if !ok {
+		entry = &probeEntry{}
+		pc.responses[key] = entry
+	}
+	pc.hosts.add(key, owner, HostName(u))
+	pc.mu.Unlock()
+
+	entry.once.Do(func() {
+		resp, err := SendProbe(u, probe, conf, maxProbeBodySize)
+		if err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error sending probe %v %v to %v: %v\n", probe.Method, probe.Path, HostKeyFromString(u), err)
+			}
+			return
+		}
+		entry.response = resp
+	})
+	return entry.response
+}
+
+// Forget drops the responses cached for a host name, once no more tasks for the host will run
+func (pc *ProbeCache) Forget(host string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	for _, key := range pc.hosts.forget(host) {
+		delete(pc.responses, key)
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
+)
+
+func TestProbeCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"status":"UP"}`))
+	}))
+	defer server.Close()
+
+	conf := &config.Config{HttpClient: server.Client()}
+	probe := &matcher.Probe{Method: "GET", Path: "/actuator/health"}
+	host := HostName(server.URL)
+
+	tests := []struct {
+		name string
+		// Host names forgotten before sending the probe, and the owner sending it
+		forget   []string
+		owner    string
+		requests int32
+	}{
+		{name: "first request is sent", owner: host, requests: 1},
+		{name: "cached for the host", owner: host, requests: 1},
+		{name: "cached for another owner", owner: "redirected.example.com", requests: 1},
+		{name: "other hosts forgotten", forget: []string{"other.example.com"}, owner: host, requests: 1},
+		{name: "sent again once the owner is forgotten", forget: []string{"redirected.example.com"}, owner: host, requests: 2},
+		{name: "sent again once the host is forgotten", forget: []string{host}, owner: host, requests: 3},
+	}
+
+	cache := NewProbeCache()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, forget := range tt.forget {
+				cache.Forget(forget)
+			}
+
+			resp := cache.Get(tt.owner, server.URL+"/page", probe, conf)
+			if resp == nil || resp.Body != `{"status":"UP"}` {
+				t.Fatalf("Get() = %v, want the probe's response", resp)
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.requests {
+				t.Errorf("%v requests sent, want %v", got, tt.requests)
+			}
+		})
+	}
+
+	cache.Forget(host)
+	if len(cache.responses) != 0 || len(cache.hosts.keys) != 0 || len(cache.hosts.hosts) != 0 {
+		t.Errorf("entries left once every host is forgotten: %v responses, %v hosts, %v keys", len(cache.responses), len(cache.hosts.keys), len(cache.hosts.hosts))
+	}
+}
+
+// startRequestLineServer answers every request with a 404, sending each request line received to the channel returned.
+// Request lines are read as is, so malformed paths reach the test rather than being rejected by an HTTP server
+func startRequestLineServer(t *testing.T) (string, chan string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			lines <- strings.TrimSpace(line)
+			conn.Write([]byte("HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), lines, func() { listener.Close() }
+}
+
+func TestSendProbe(t *testing.T) {
+	address, lines, shutdown := startRequestLineServer(t)
+	defer shutdown()
+
+	tests := []struct {
+		name string
+		// Whether the server is used as a proxy, rather than requested directly
+		proxy bool
+		url   string
+		path  string
+		want  string
+	}{
+		{name: "path", url: "http://" + address + "/page", path: "/whoareyou-1a2b", want: "GET /whoareyou-1a2b HTTP/1.1"},
+		{name: "malformed path", url: "http://" + address + "/page", path: "/whoareyou-1a2b/%zz", want: "GET /whoareyou-1a2b/%zz HTTP/1.1"},
+		{
+			name:  "path through a proxy",
+			proxy: true,
+			url:   "http://target.example.com/page",
+			path:  "/whoareyou-1a2b",
+			want:  "GET http://target.example.com/whoareyou-1a2b HTTP/1.1",
+		},
+		{
+			name:  "malformed path through a proxy",
+			proxy: true,
+			url:   "http://target.example.com/page",
+			path:  "/whoareyou-1a2b/%zz",
+			want:  "GET http://target.example.com/whoareyou-1a2b/%zz HTTP/1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{ProxyRotation: "round-robin", ProxyCooldown: time.Minute}
+			if tt.proxy {
+				conf.Proxies = []*url.URL{{Scheme: "http", Host: address}}
+			}
+			conf.HttpClient = CreateClient(5, conf)
+
+			resp, err := SendProbe(tt.url, &matcher.Probe{Method: "GET", Path: tt.path}, conf, 1024)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 404 {
+				t.Errorf("status = %v, want 404", resp.StatusCode)
+			}
+			if line := <-lines; line != tt.want {
+				t.Errorf("request line = %q, want %q", line, tt.want)
+			}
+		})
+	}
+}
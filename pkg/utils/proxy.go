@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type proxyContextKey struct{}
+
+type proxyEntry struct {
+	url            *url.URL
+	unhealthyUntil time.Time
+}
+
+// ProxyPool rotates requests across proxies, skipping proxies that recently failed until their cooldown ends
+type ProxyPool struct {
+	proxies  []*proxyEntry
+	rotation string
+	cooldown time.Duration
+	next     int
+	mu       sync.Mutex
+}
+
+func NewProxyPool(proxies []*url.URL, rotation string, cooldown time.Duration) *ProxyPool {
+	pool := &ProxyPool{
+		rotation: rotation,
+		cooldown: cooldown,
+	}
+	for _, proxy := range proxies {
+		pool.proxies = append(pool.proxies, &proxyEntry{url: proxy})
+	}
+	return pool
+}
+
+// Next returns the next healthy proxy to use. If every proxy is unhealthy, the one closest to the end of its
+// cooldown is returned
+func (p *ProxyPool) Next() *url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var healthy []int
+	for i, proxy := range p.proxies {
+		if now.After(proxy.unhealthyUntil) {
+			healthy = append(healthy, i)
+		}
+	}
+
+	if len(healthy) == 0 {
+		soonest := p.proxies[0]
+		for _, proxy := range p.proxies {
+			if proxy.unhealthyUntil.Before(soonest.unhealthyUntil) {
+				soonest = proxy
+			}
+		}
+		return soonest.url
+	}
+
+	if p.rotation == "random" {
+		return p.proxies[healthy[rand.Intn(len(healthy))]].url
+	}
+
+	// Round robin, starting from the next proxy after the last one used
+	for i := 0; i < len(p.proxies); i++ {
+		index := (p.next + i) % len(p.proxies)
+		if now.After(p.proxies[index].unhealthyUntil) {
+			p.next = index + 1
+			return p.proxies[index].url
+		}
+	}
+	return p.proxies[healthy[0]].url
+}
+
+// MarkFailed marks a proxy as unhealthy, so it's skipped until the cooldown ends
+func (p *ProxyPool) MarkFailed(proxy *url.URL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, entry := range p.proxies {
+		if entry.url == proxy {
+			entry.unhealthyUntil = time.Now().Add(p.cooldown)
+		}
+	}
+}
+
+// proxyTransport picks a proxy from the pool for each request, and marks it as failed if the connection
+// through it can't be made
+type proxyTransport struct {
+	transport *http.Transport
+	pool      *ProxyPool
+}
+
+func (pt *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxy := pt.pool.Next()
+	req = req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, proxy))
+
+	// HTTP proxies are sent the full URL of http:// requests, but only when the path isn't set as is (i.e. a malformed
+	// path sent by a probe), so build it for those
+	if req.URL.Scheme == "http" && strings.HasPrefix(req.URL.Opaque, "/") && !strings.HasPrefix(req.URL.Opaque, "//") &&
+		(proxy.Scheme == "http" || proxy.Scheme == "https") {
+		u := *req.URL
+		u.Opaque = "//" + u.Host + u.Opaque
+		req.URL = &u
+	}
+
+	resp, err := pt.transport.RoundTrip(req)
+	if err != nil && isProxyError(err) {
+		pt.pool.MarkFailed(proxy)
+	}
+	return resp, err
+}
+
+func proxyFromContext(req *http.Request) (*url.URL, error) {
+	proxy, _ := req.Context().Value(proxyContextKey{}).(*url.URL)
+	return proxy, nil
+}
+
+// Replies of a SOCKS proxy that couldn't connect to the target. The proxy itself is working, so it isn't marked as failed
+var socksTargetReplies = []string{
+	"network unreachable", "host unreachable", "connection refused", "TTL expired", "connection not allowed by ruleset",
+}
+
+// isProxyError checks whether an error came from connecting or authenticating to the proxy, rather than the target
+func isProxyError(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+
+	// Failing to connect to the proxy is reported as proxyconnect, and failing the SOCKS handshake (or the proxy failing
+	// to connect to the target) as socks connect
+	switch {
+	case opErr.Op == "proxyconnect":
+		return true
+	case strings.HasPrefix(opErr.Op, "socks"):
+		for _, reply := range socksTargetReplies {
+			if opErr.Err != nil && strings.HasSuffix(opErr.Err.Error(), reply) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// startSocksServer accepts SOCKS5 connections without authentication, and answers every CONNECT request with the reply
+// code given, returning the proxy's address and a function to shut it down
+func startSocksServer(t *testing.T, reply byte) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				// Greeting: version, number of methods and the methods
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+
+				// Request: version, command, reserved, address type, address and port
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				var address []byte
+				switch request[3] {
+				case 1:
+					address = make([]byte, 4)
+				case 4:
+					address = make([]byte, 16)
+				case 3:
+					length := make([]byte, 1)
+					if _, err := io.ReadFull(conn, length); err != nil {
+						return
+					}
+					address = make([]byte, length[0])
+				}
+				if _, err := io.ReadFull(conn, append(address, 0, 0)); err != nil {
+					return
+				}
+				conn.Write([]byte{5, reply, 0, 1, 0, 0, 0, 0, 0, 0})
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestProxyFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply byte
+		// Whether the proxy is shut down before the request, so it can't be connected to
+		down   bool
+		failed bool
+	}{
+		{name: "host unreachable", reply: 4},
+		{name: "connection refused by the target", reply: 5},
+		{name: "network unreachable", reply: 3},
+		{name: "general failure", reply: 1, failed: true},
+		{name: "proxy down", down: true, failed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, shutdown := startSocksServer(t, tt.reply)
+			defer shutdown()
+			if tt.down {
+				shutdown()
+			}
+
+			proxy := &url.URL{Scheme: "socks5", Host: address}
+			pool := NewProxyPool([]*url.URL{proxy}, "round-robin", time.Minute)
+			transport := &proxyTransport{transport: &http.Transport{Proxy: proxyFromContext}, pool: pool}
+
+			req, _ := http.NewRequest("GET", "http://dead.example.com/", nil)
+			if _, err := transport.RoundTrip(req); err == nil {
+				t.Fatal("request through the proxy succeeded, want an error")
+			}
+
+			if failed := !pool.proxies[0].unhealthyUntil.IsZero(); failed != tt.failed {
+				t.Errorf("proxy marked as failed = %v, want %v", failed, tt.failed)
+			}
+		})
+	}
+}
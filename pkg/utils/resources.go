@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
+)
+
+// Maximum number of icons to fetch per page, and the maximum size of an icon
+const maxFavicons = 4
+const maxFaviconSize = 1024 * 1024
+
+// Maximum number of URLs the resource cache remembers, including failed fetches
+const maxCachedUrls = 100000
+
+// ResourceCache caches resources fetched from pages (i.e. scripts and stylesheets) across targets. Resources are stored by the hash
+// of their content, so the same file served from different URLs (i.e. a library on several sites) is only stored once.
+// Failed fetches are cached too, so they aren't retried for every page referencing them
+type ResourceCache struct {
+	// URLs and hashes in the order they were added, so the oldest are evicted first once the cache is full
+	urls     map[string]*list.Element
+	urlOrder *list.List
+	contents map[string]*list.Element
+	order    *list.List
+	size     int64
+	maxBytes int64
+	maxUrls  int
+	mu       sync.Mutex
+}
+
+type cachedUrl struct {
+	url  string
+	hash string
+}
+
+type cachedContent struct {
+	hash    string
+	content []byte
+	// URLs the content was fetched from, removed from the cache along with the content
+	urls map[string]bool
+}
+
+func NewResourceCache(maxBytes int64) *ResourceCache {
+	return &ResourceCache{
+		urls:     make(map[string]*list.Element),
+		urlOrder: list.New(),
+		contents: make(map[string]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+		maxUrls:  maxCachedUrls,
+	}
+}
+
+// Get returns the cached content of a URL, and whether the URL was fetched before. The content is nil if the fetch failed
+func (rc *ResourceCache) Get(u string) ([]byte, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.urls[u]
+	if !ok {
+		return nil, false
+	}
+
+	hash := element.Value.(*cachedUrl).hash
+	if hash == "" {
+		return nil, true
+	}
+	return rc.contents[hash].Value.(*cachedContent).content, true
+}
+
+// Add caches the content fetched from a URL, returning the hash of the content. Nil content records a failed fetch
+func (rc *ResourceCache) Add(u string, content []byte) string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.removeUrl(u)
+
+	hash := ""
+	if content != nil {
+		sum := sha256.Sum256(content)
+		hash = hex.EncodeToString(sum[:])
+
+		element, ok := rc.contents[hash]
+		if !ok {
+			element = rc.order.PushBack(&cachedContent{hash: hash, content: content, urls: map[string]bool{}})
+			rc.contents[hash] = element
+			rc.size += int64(len(content))
+		} else {
+			rc.order.MoveToBack(element)
+		}
+		element.Value.(*cachedContent).urls[u] = true
+	}
+	rc.urls[u] = rc.urlOrder.PushBack(&cachedUrl{url: u, hash: hash})
+
+	// The content just added is kept even if it's larger than the cache
+	for rc.size > rc.maxBytes && rc.order.Len() > 1 {
+		rc.removeContent(rc.order.Front().Value.(*cachedContent))
+	}
+	for len(rc.urls) > rc.maxUrls {
+		rc.removeUrl(rc.urlOrder.Front().Value.(*cachedUrl).url)
+	}
+	return hash
+}
+
+// removeUrl removes a URL from the cache, and its content if no other URL has the same content
+func (rc *ResourceCache) removeUrl(u string) {
+	element, ok := rc.urls[u]
+	if !ok {
+		return
+	}
+	rc.urlOrder.Remove(element)
+	delete(rc.urls, u)
+
+	hash := element.Value.(*cachedUrl).hash
+	if contentElement, ok := rc.contents[hash]; ok {
+		content := contentElement.Value.(*cachedContent)
+		delete(content.urls, u)
+		if len(content.urls) == 0 {
+			rc.removeContent(content)
+		}
+	}
+}
+
+// removeContent removes content from the cache, along with every URL it was fetched from, so they are fetched again
+func (rc *ResourceCache) removeContent(content *cachedContent) {
+	rc.order.Remove(rc.contents[content.hash])
+	delete(rc.contents, content.hash)
+	rc.size -= int64(len(content.content))
+
+	for u := range content.urls {
+		if element, ok := rc.urls[u]; ok {
+			rc.urlOrder.Remove(element)
+			delete(rc.urls, u)
+		}
+	}
+}
+
+// FetchScripts downloads the scripts referenced by a page that are on the same origin or an allowed domain, up to the
+// maximum number of scripts and size configured, and returns their contents
+func FetchScripts(pageUrl string, scriptSrcs []string, conf *config.Config, cache *ResourceCache) []string {
+	return fetchResources(pageUrl, scriptSrcs, conf.ScriptDomains, conf.MaxScripts, conf.MaxScriptSize, conf, cache)
+}
+
+// FetchStylesheets downloads the stylesheets linked from a page that are on the same origin or an allowed domain, up to
+// the maximum number of stylesheets and size configured, and returns their contents
+func FetchStylesheets(pageUrl string, hrefs []string, conf *config.Config, cache *ResourceCache) []string {
+	return fetchResources(pageUrl, hrefs, conf.CssDomains, conf.MaxStylesheets, conf.MaxCssSize, conf, cache)
+}
+
+func fetchResources(pageUrl string, srcs []string, allowedDomains []string, maxCount int, maxBytes int64, conf *config.Config, cache *ResourceCache) []string {
+	var contents []string
+	fetched := map[string]bool{}
+
+	for _, src := range srcs {
+		if len(fetched) >= maxCount {
+			break
+		}
+
+		resource := ResolveUrl(pageUrl, src)
+		if resource == "" || fetched[resource] || !isAllowedResource(pageUrl, resource, allowedDomains) {
+			continue
+		}
+		fetched[resource] = true
+
+		if content := fetchCached(resource, maxBytes, conf, cache); content != nil {
+			contents = append(contents, string(content))
+		}
+	}
+	return contents
+}
+
+// FetchFavicons downloads the site's /favicon.ico and the icons linked from a page, returning the hashes of each icon
+// found. Linked icons are often served from a CDN, so they are fetched from any domain
+func FetchFavicons(pageUrl string, icons []string, conf *config.Config, cache *ResourceCache) []matcher.Favicon {
+	var favicons []matcher.Favicon
+	fetched := map[string]bool{}
+
+	for _, icon := range append([]string{"/favicon.ico"}, icons...) {
+		if len(fetched) >= maxFavicons {
+			break
+		}
+
+		resource := ResolveUrl(pageUrl, icon)
+		if resource == "" || fetched[resource] {
+			continue
+		}
+		fetched[resource] = true
+
+		// Missing icons are often answered with an HTML error page rather than a 404
+		content := fetchCached(resource, maxFaviconSize, conf, cache)
+		if len(content) == 0 || strings.HasPrefix(http.DetectContentType(content), "text/html") {
+			continue
+		}
+		favicons = append(favicons, matcher.NewFavicon(resource, content))
+	}
+	return favicons
+}
+
+// fetchCached returns the content of a resource from the cache, fetching it if it wasn't fetched before. The content is
+// nil if the fetch failed
+func fetchCached(resource string, maxBytes int64, conf *config.Config, cache *ResourceCache) []byte {
+	content, cached := cache.Get(resource)
+	if cached {
+		return content
+	}
+
+	content, err := FetchResource(resource, conf, maxBytes)
+	if err != nil && conf.DebugMode {
+		conf.Utils.PrintRed(os.Stderr, "error fetching %v: %v\n", resource, err)
+	}
+	cache.Add(resource, content)
+	return content
+}
+
+// isAllowedResource checks whether a resource is on the same origin as the page, or on (a subdomain of) an allowed domain
+func isAllowedResource(pageUrl string, resource string, allowedDomains []string) bool {
+	if HostKeyFromString(pageUrl) == HostKeyFromString(resource) {
+		return true
+	}
+
+	host := HostName(resource)
+	for _, domain := range allowedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveUrl resolves a (possibly relative) reference against a base URL, returning an empty string if either is
+// invalid or the result isn't an HTTP(S) URL
+func ResolveUrl(base string, reference string) string {
+	if reference == "" {
+		return ""
+	}
+
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	referenceUrl, err := url.Parse(reference)
+	if err != nil {
+		return ""
+	}
+
+	resolved := baseUrl.ResolveReference(referenceUrl)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	resolved.Fragment = ""
+	return resolved.String()
+}
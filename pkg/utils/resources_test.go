@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestResourceCache(t *testing.T) {
+	type add struct {
+		url     string
+		content string
+		failed  bool
+	}
+	type get struct {
+		url     string
+		content string
+		cached  bool
+	}
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		maxUrls  int
+		adds     []add
+		gets     []get
+		size     int64
+	}{
+		{
+			name:     "content and failed fetches are cached",
+			maxBytes: 100,
+			maxUrls:  10,
+			adds:     []add{{url: "a", content: "aaaa"}, {url: "b", failed: true}},
+			gets:     []get{{url: "a", content: "aaaa", cached: true}, {url: "b", cached: true}, {url: "c"}},
+			size:     4,
+		},
+		{
+			name:     "same content from several URLs is stored once",
+			maxBytes: 100,
+			maxUrls:  10,
+			adds:     []add{{url: "a", content: "same"}, {url: "b", content: "same"}},
+			gets:     []get{{url: "a", content: "same", cached: true}, {url: "b", content: "same", cached: true}},
+			size:     4,
+		},
+		{
+			name:     "evicted content is fetched again",
+			maxBytes: 8,
+			maxUrls:  10,
+			adds:     []add{{url: "a", content: "aaaa"}, {url: "b", content: "bbbb"}, {url: "c", content: "cccc"}},
+			gets:     []get{{url: "a"}, {url: "b", content: "bbbb", cached: true}, {url: "c", content: "cccc", cached: true}},
+			size:     8,
+		},
+		{
+			name:     "evicted content removes every URL it was fetched from",
+			maxBytes: 8,
+			maxUrls:  10,
+			adds:     []add{{url: "a1", content: "aaaa"}, {url: "a2", content: "aaaa"}, {url: "b", content: "bbbb"}, {url: "c", content: "cccc"}},
+			gets:     []get{{url: "a1"}, {url: "a2"}, {url: "b", content: "bbbb", cached: true}},
+			size:     8,
+		},
+		{
+			name:     "content added again is kept over older content",
+			maxBytes: 8,
+			maxUrls:  10,
+			adds:     []add{{url: "a", content: "aaaa"}, {url: "b", content: "bbbb"}, {url: "a2", content: "aaaa"}, {url: "c", content: "cccc"}},
+			gets:     []get{{url: "a", content: "aaaa", cached: true}, {url: "a2", content: "aaaa", cached: true}, {url: "b"}},
+			size:     8,
+		},
+		{
+			name:     "content larger than the cache is kept until the next add",
+			maxBytes: 2,
+			maxUrls:  10,
+			adds:     []add{{url: "a", content: "aaaa"}},
+			gets:     []get{{url: "a", content: "aaaa", cached: true}},
+			size:     4,
+		},
+		{
+			name:     "oldest URLs are removed once the index is full",
+			maxBytes: 100,
+			maxUrls:  2,
+			adds:     []add{{url: "a", content: "aaaa"}, {url: "b", failed: true}, {url: "c", content: "cccc"}},
+			gets:     []get{{url: "a"}, {url: "b", cached: true}, {url: "c", content: "cccc", cached: true}},
+			size:     4,
+		},
+		{
+			name:     "URL fetched again replaces its content",
+			maxBytes: 100,
+			maxUrls:  10,
+			adds:     []add{{url: "a", content: "old"}, {url: "a", content: "new!"}},
+			gets:     []get{{url: "a", content: "new!", cached: true}},
+			size:     4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewResourceCache(tt.maxBytes)
+			cache.maxUrls = tt.maxUrls
+			for _, a := range tt.adds {
+				var content []byte
+				if !a.failed {
+					content = []byte(a.content)
+				}
+				cache.Add(a.url, content)
+			}
+
+			for _, g := range tt.gets {
+				content, cached := cache.Get(g.url)
+				if cached != g.cached || string(content) != g.content {
+					t.Errorf("Get(%v) = %q, %v, want %q, %v", g.url, content, cached, g.content, g.cached)
+				}
+			}
+			if cache.size != tt.size {
+				t.Errorf("size = %v, want %v", cache.size, tt.size)
+			}
+			if len(cache.urls) != cache.urlOrder.Len() || len(cache.contents) != cache.order.Len() {
+				t.Errorf("index out of sync: %v urls (%v ordered), %v contents (%v ordered)", len(cache.urls), cache.urlOrder.Len(), len(cache.contents), cache.order.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+// Longest time to wait before retrying a request, including when asked to by a Retry-After header
+const maxRetryDelay = 60 * time.Second
+
+// Throttler slows down requests to a host that is rate limiting us, and speeds back up once it stops
+type Throttler interface {
+	Throttle(host string, delay time.Duration)
+	Recover(host string)
+}
+
+// SendRequestWithRetries sends a request, retrying transient network errors and 429, 502, 503 and 504 responses with a jittered
+// exponential backoff (or the delay in the Retry-After header). It returns the number of attempts made
+func SendRequestWithRetries(u string, conf *config.Config, throttler Throttler) (Response, int, error) {
+	host := HostName(u)
+
+	var resp Response
+	var err error
+	attempt := 0
+	for {
+		attempt += 1
+		resp, err = SendRequest(u, conf)
+
+		retryable := isRetryableError(err) || (err == nil && isRetryableStatus(resp.StatusCode))
+		if throttler != nil {
+			if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+				throttler.Throttle(host, retryAfter(resp.Headers))
+			} else if err == nil {
+				throttler.Recover(host)
+			}
+		}
+
+		if !retryable || attempt > conf.Retries {
+			return resp, attempt, err
+		}
+
+		delay := backoff(conf.RetryBackoff, attempt)
+		if err == nil {
+			if wait := retryAfter(resp.Headers); wait > delay {
+				delay = wait
+			}
+		}
+
+		if conf.DebugMode {
+			reason := strconv.Itoa(resp.StatusCode)
+			if err != nil {
+				reason = err.Error()
+			}
+			conf.Utils.PrintYellow(os.Stderr, "retrying %v in %v (attempt %v of %v): %v\n", u, delay.Round(time.Millisecond), attempt+1, conf.Retries+1, reason)
+		}
+		time.Sleep(delay)
+	}
+}
+
+// isRetryableError checks for errors likely to be transient (timeouts and dropped connections), rather than errors
+// like refused connections or failed DNS lookups that won't change on a retry
+func isRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "connection reset") || strings.Contains(message, "broken pipe") ||
+		strings.Contains(message, "EOF") || strings.Contains(message, "timeout")
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// backoff returns the delay before the next attempt, doubling with each attempt, with half of it randomized so
+// workers retrying at the same time don't stay in sync. A base of 0 disables the backoff
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	// Delays that overflow when doubled are capped, as are those over the maximum
+	shift := uint(attempt - 1)
+	delay := base << shift
+	if shift >= 63 || delay>>shift != base || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter parses the Retry-After header, which is either a number of seconds or an HTTP date
+func retryAfter(headers http.Header) time.Duration {
+	value := strings.TrimSpace(headers.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    time.Duration
+		attempt int
+		// The delay before randomization, of which the backoff is between half and all
+		want time.Duration
+	}{
+		{name: "first attempt", base: 500 * time.Millisecond, attempt: 1, want: 500 * time.Millisecond},
+		{name: "second attempt", base: 500 * time.Millisecond, attempt: 2, want: time.Second},
+		{name: "third attempt", base: 500 * time.Millisecond, attempt: 3, want: 2 * time.Second},
+		{name: "capped", base: 500 * time.Millisecond, attempt: 10, want: maxRetryDelay},
+		{name: "overflow", base: 500 * time.Millisecond, attempt: 40, want: maxRetryDelay},
+		{name: "shift past the size of a duration", base: time.Millisecond, attempt: 100, want: maxRetryDelay},
+		{name: "base over the maximum", base: 2 * maxRetryDelay, attempt: 1, want: maxRetryDelay},
+		{name: "no backoff", base: 0, attempt: 1, want: 0},
+		{name: "no backoff on later attempts", base: 0, attempt: 5, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := backoff(tt.base, tt.attempt); got < tt.want/2 || got > tt.want {
+					t.Fatalf("backoff(%v, %v) = %v, want between %v and %v", tt.base, tt.attempt, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of tasks queued before Add blocks, to keep memory bounded while still interleaving hosts
+const maxQueuedTasks = 50000
+
+// Scheduler hands out tasks to workers, interleaving hosts in round robin order so no single host gets all the
+// workers. It enforces a global request rate, and a rate and concurrency limit per host, on every request sent
+// through Acquire (see LimitTransport), not only the first request of each task
+type Scheduler struct {
+	queues map[string][]interface{}
+	// Hosts with queued tasks, in the order they are served
+	hosts []string
+	next  int
+
+	// Running tasks and requests in flight by host, and requests waiting to start by host
+	active    map[string]int
+	running   int
+	inflight  map[string]int
+	waiting   map[string]int
+	nextStart map[string]time.Time
+	// Extra delay between requests to hosts that are rate limiting us
+	penalty map[string]time.Duration
+	queued  int
+	closed  bool
+
+	globalInterval  time.Duration
+	hostInterval    time.Duration
+	hostConcurrency int
+	nextGlobalStart time.Time
+
+	mu   sync.Mutex
+	cond *sync.Cond
+}
+
+// NewScheduler creates a scheduler. Rates are in requests per second, and a rate or concurrency of 0 is unlimited
+func NewScheduler(globalRate float64, hostRate float64, hostConcurrency int) *Scheduler {
+	s := &Scheduler{
+		queues:          make(map[string][]interface{}),
+		active:          make(map[string]int),
+		inflight:        make(map[string]int),
+		waiting:         make(map[string]int),
+		nextStart:       make(map[string]time.Time),
+		penalty:         make(map[string]time.Duration),
+		hostConcurrency: hostConcurrency,
+	}
+	if globalRate > 0 {
+		s.globalInterval = time.Duration(float64(time.Second) / globalRate)
+	}
+	if hostRate > 0 {
+		s.hostInterval = time.Duration(float64(time.Second) / hostRate)
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Add queues a task for a host, blocking while the queue is full
+func (s *Scheduler) Add(host string, task interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.queued >= maxQueuedTasks {
+		s.cond.Wait()
+	}
+	s.enqueue(host, task)
+}
+
+// Push queues a task for a host without blocking, even if the queue is full or the scheduler is closed. It's used
+// by running tasks to add follow up tasks (i.e. pages found while crawling), which would deadlock if they blocked
+func (s *Scheduler) Push(host string, task interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enqueue(host, task)
+}
+
+func (s *Scheduler) enqueue(host string, task interface{}) {
+	if len(s.queues[host]) == 0 {
+		s.hosts = append(s.hosts, host)
+	}
+	s.queues[host] = append(s.queues[host], task)
+	s.queued += 1
+	s.cond.Broadcast()
+}
+
+// Close marks that no more tasks will be added from input, so Next returns once the queue is empty and no running
+// task can push more
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+// Next blocks until a task can be started without exceeding the limits, and returns it with its host. Once the
+// scheduler is closed and every task is finished, ok is false. Hosts that can't send a request yet (because of their
+// rate limit, or requests already waiting for it) are skipped, so workers aren't handed tasks that would only wait
+func (s *Scheduler) Next() (host string, task interface{}, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.queued == 0 && s.closed && s.running == 0 {
+			return "", nil, false
+		}
+
+		now := time.Now()
+		var wakeAt time.Time
+
+		for i := 0; i < len(s.hosts); i++ {
+			index := (s.next + i) % len(s.hosts)
+			candidate := s.hosts[index]
+
+			if s.hostConcurrency > 0 && s.active[candidate] >= s.hostConcurrency {
+				continue
+			}
+			if s.waiting[candidate] > 0 {
+				continue
+			}
+			if start := s.nextStart[candidate]; start.After(now) {
+				if wakeAt.IsZero() || start.Before(wakeAt) {
+					wakeAt = start
+				}
+				continue
+			}
+
+			host, task = candidate, s.queues[candidate][0]
+			s.queues[candidate] = s.queues[candidate][1:]
+			s.queued -= 1
+			s.active[candidate] += 1
+			s.running += 1
+			s.next = index + 1
+
+			// Stop serving hosts with no queued tasks
+			if len(s.queues[candidate]) == 0 {
+				delete(s.queues, candidate)
+				s.hosts = append(s.hosts[:index], s.hosts[index+1:]...)
+				s.next = index
+			}
+			s.cond.Broadcast()
+			return host, task, true
+		}
+
+		// Nothing can start now, so wait for a task to be added or finish, or for a host's rate limit to pass
+		s.wait(now, wakeAt)
+	}
+}
+
+// Acquire blocks until a request to the host can be sent without exceeding the global and per host limits, and
+// reserves its start. Release must be called once the request is finished
+func (s *Scheduler) Acquire(host string) {
+	s.mu.Lock()
+
+	s.waiting[host] += 1
+	for {
+		now := time.Now()
+		if s.hostConcurrency > 0 && s.inflight[host] >= s.hostConcurrency {
+			s.cond.Wait()
+			continue
+		}
+		if start := s.nextStart[host]; start.After(now) {
+			s.wait(now, start)
+			continue
+		}
+		break
+	}
+	s.waiting[host] -= 1
+	if s.waiting[host] == 0 {
+		delete(s.waiting, host)
+	}
+	s.inflight[host] += 1
+
+	// Reserve the next start time for the host and globally, then wait for it outside of the lock
+	start := time.Now()
+	if s.globalInterval > 0 {
+		if s.nextGlobalStart.After(start) {
+			start = s.nextGlobalStart
+		}
+		s.nextGlobalStart = start.Add(s.globalInterval)
+	}
+	if s.hostInterval > 0 || s.penalty[host] > 0 {
+		s.nextStart[host] = start.Add(s.hostInterval + s.penalty[host])
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	time.Sleep(time.Until(start))
+}
+
+// Release marks a request to the host as finished
+func (s *Scheduler) Release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight[host] -= 1
+	if s.inflight[host] <= 0 {
+		delete(s.inflight, host)
+		s.forget(host)
+	}
+	s.cond.Broadcast()
+}
+
+// wait waits for the state of the scheduler to change, or for the time given (if any) to be reached. The lock must
+// be held
+func (s *Scheduler) wait(now time.Time, wakeAt time.Time) {
+	if !wakeAt.IsZero() {
+		time.AfterFunc(wakeAt.Sub(now), func() {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		})
+	}
+	s.cond.Wait()
+}
+
+// forget drops the rate limit state of a host with nothing queued, running or in flight, once its delay has passed.
+// The lock must be held
+func (s *Scheduler) forget(host string) {
+	_, queued := s.queues[host]
+	if queued || s.active[host] > 0 || s.inflight[host] > 0 || s.waiting[host] > 0 {
+		return
+	}
+	if time.Now().After(s.nextStart[host]) {
+		delete(s.nextStart, host)
+	}
+}
+
+// Done marks a task for the host as finished, and returns whether the host has no other task queued or running, so
+// state kept for it can be dropped
+func (s *Scheduler) Done(host string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running -= 1
+	s.active[host] -= 1
+	s.cond.Broadcast()
+	if s.active[host] > 0 {
+		return false
+	}
+
+	delete(s.active, host)
+	s.forget(host)
+	_, queued := s.queues[host]
+	return !queued
+}
+
+// Throttle slows down requests to a host that responded with a 429, doubling the delay between its requests each time
+// (up to a minute). No request to the host starts until the delay, or the Retry-After delay provided, has passed
+func (s *Scheduler) Throttle(host string, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	penalty := s.penalty[host] * 2
+	if penalty < time.Second {
+		penalty = time.Second
+	}
+	if penalty > time.Minute {
+		penalty = time.Minute
+	}
+	s.penalty[host] = penalty
+
+	if retryAfter < penalty {
+		retryAfter = penalty
+	}
+	if resume := time.Now().Add(retryAfter); resume.After(s.nextStart[host]) {
+		s.nextStart[host] = resume
+	}
+}
+
+// Recover halves the delay between requests to a host once it stops rate limiting us
+func (s *Scheduler) Recover(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if penalty, ok := s.penalty[host]; ok {
+		if penalty/2 < time.Second {
+			delete(s.penalty, host)
+		} else {
+			s.penalty[host] = penalty / 2
+		}
+	}
+}
+
+// Limiter limits the requests sent to each host, i.e. the Scheduler
+type Limiter interface {
+	Acquire(host string)
+	Release(host string)
+}
+
+// LimitTransport wraps a transport so every request sent through it (including each redirect followed) waits for the
+// limiter, and holds its place until the response body is closed
+func LimitTransport(transport http.RoundTripper, limiter Limiter) http.RoundTripper {
+	return &limitedTransport{transport: transport, limiter: limiter}
+}
+
+type limitedTransport struct {
+	transport http.RoundTripper
+	limiter   Limiter
+}
+
+func (lt *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	lt.limiter.Acquire(host)
+
+	resp, err := lt.transport.RoundTrip(req)
+	if err != nil {
+		lt.limiter.Release(host)
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { lt.limiter.Release(host) }}
+	return resp, nil
+}
+
+// releasingBody releases a request's place in the limiter once its body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (rb *releasingBody) Close() error {
+	err := rb.ReadCloser.Close()
+	rb.once.Do(rb.release)
+	return err
+}
+
+// HostName returns the lowercased host name of a URL (without the port), used to apply per host limits
+func HostName(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return strings.ToLower(u.Hostname())
+}
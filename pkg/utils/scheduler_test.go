@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerInterleaving(t *testing.T) {
+	tests := []struct {
+		name  string
+		hosts []string
+		want  []string
+	}{
+		{
+			name:  "single host",
+			hosts: []string{"a", "a", "a"},
+			want:  []string{"a", "a", "a"},
+		},
+		{
+			name:  "hosts served in turn",
+			hosts: []string{"a", "a", "a", "b", "b", "c"},
+			want:  []string{"a", "b", "c", "a", "b", "a"},
+		},
+		{
+			name:  "order of first task kept",
+			hosts: []string{"b", "a", "b", "a"},
+			want:  []string{"b", "a", "b", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(0, 0, 0)
+			for i, host := range tt.hosts {
+				s.Add(host, i)
+			}
+			s.Close()
+
+			var got []string
+			for {
+				host, _, ok := s.Next()
+				if !ok {
+					break
+				}
+				got = append(got, host)
+				s.Done(host)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hosts served = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerHostConcurrency(t *testing.T) {
+	s := NewScheduler(0, 0, 1)
+	s.Add("a", 1)
+	s.Add("a", 2)
+	s.Add("b", 3)
+	s.Close()
+
+	// The second task for a can't start until the first is done, so b is served first
+	host, _, _ := s.Next()
+	if host != "a" {
+		t.Fatalf("first host = %v, want a", host)
+	}
+	host, _, _ = s.Next()
+	if host != "b" {
+		t.Fatalf("second host = %v, want b", host)
+	}
+
+	next := make(chan string)
+	go func() {
+		host, _, _ := s.Next()
+		next <- host
+	}()
+	select {
+	case host := <-next:
+		t.Fatalf("Next() returned %v while a was at its concurrency limit", host)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.Done("a")
+	select {
+	case host := <-next:
+		if host != "a" {
+			t.Fatalf("third host = %v, want a", host)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Next() didn't return once a finished a task")
+	}
+}
+
+func TestSchedulerRequestLimits(t *testing.T) {
+	tests := []struct {
+		name            string
+		globalRate      float64
+		hostRate        float64
+		hostConcurrency int
+		hosts           []string
+		// Minimum time sending the requests concurrently must take
+		minDuration time.Duration
+		// Maximum requests in flight to a single host
+		maxInflight int32
+	}{
+		{
+			name:        "unlimited",
+			hosts:       []string{"a", "a", "a", "a"},
+			maxInflight: 4,
+		},
+		{
+			name:        "host rate",
+			hostRate:    20,
+			hosts:       []string{"a", "a", "a", "a", "b"},
+			minDuration: 150 * time.Millisecond,
+			maxInflight: 4,
+		},
+		{
+			name:        "global rate across hosts",
+			globalRate:  20,
+			hosts:       []string{"a", "b", "c", "d"},
+			minDuration: 150 * time.Millisecond,
+			maxInflight: 1,
+		},
+		{
+			name:            "host concurrency",
+			hostConcurrency: 2,
+			hosts:           []string{"a", "a", "a", "a", "a", "a"},
+			maxInflight:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(tt.globalRate, tt.hostRate, tt.hostConcurrency)
+
+			var mu sync.Mutex
+			inflight := map[string]int32{}
+			var maxInflight int32
+
+			start := time.Now()
+			var wg sync.WaitGroup
+			for _, host := range tt.hosts {
+				wg.Add(1)
+				go func(host string) {
+					defer wg.Done()
+					s.Acquire(host)
+
+					mu.Lock()
+					inflight[host] += 1
+					if inflight[host] > maxInflight {
+						maxInflight = inflight[host]
+					}
+					mu.Unlock()
+
+					time.Sleep(20 * time.Millisecond)
+
+					mu.Lock()
+					inflight[host] -= 1
+					mu.Unlock()
+					s.Release(host)
+				}(host)
+			}
+			wg.Wait()
+
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Errorf("requests took %v, want at least %v", elapsed, tt.minDuration)
+			}
+			if maxInflight > tt.maxInflight {
+				t.Errorf("%v requests in flight to a host, want at most %v", maxInflight, tt.maxInflight)
+			}
+		})
+	}
+}
+
+func TestLimitTransport(t *testing.T) {
+	var inflight, maxInflight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inflight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInflight, max, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inflight, -1)
+
+		// Redirects count as requests too
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	s := NewScheduler(0, 0, 1)
+	client := &http.Client{Transport: LimitTransport(http.DefaultTransport, s)}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := "/"
+			if i%2 == 0 {
+				path = "/redirect"
+			}
+			resp, err := client.Get(server.URL + path)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+
+	if maxInflight != 1 {
+		t.Errorf("%v requests in flight, want 1", maxInflight)
+	}
+	if len(s.inflight) != 0 || len(s.waiting) != 0 {
+		t.Errorf("requests not released: %v in flight, %v waiting", s.inflight, s.waiting)
+	}
+}
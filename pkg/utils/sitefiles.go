@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
+)
+
+// Maximum size of a site file
+const maxSiteFileSize = 512 * 1024
+
+// Paths of the site files fetched for each host, in the order they are tried. security.txt moved to /.well-known, but
+// is still often served from the root
+var siteFilePaths = []struct {
+	file string
+	path string
+}{
+	{matcher.RobotsFile, "/robots.txt"},
+	{matcher.SecurityFile, "/.well-known/security.txt"},
+	{matcher.SecurityFile, "/security.txt"},
+	{matcher.HumansFile, "/humans.txt"},
+	{matcher.ManifestFile, "/manifest.json"},
+	{matcher.BrowserConfigFile, "/browserconfig.xml"},
+}
+
+// SiteFileCache fetches the site files of each host (scheme, host and port) once, and caches what was found until
+// Forget is called for the host name
+type SiteFileCache struct {
+	hosts map[string]*siteFilesEntry
+	names *hostIndex
+	mu    sync.Mutex
+}
+
+type siteFilesEntry struct {
+	once  sync.Once
+	files *matcher.SiteFiles
+}
+
+func NewSiteFileCache() *SiteFileCache {
+	return &SiteFileCache{
+		hosts: make(map[string]*siteFilesEntry),
+		names: newHostIndex(),
+	}
+}
+
+// Get returns the site files of a URL's host, fetching them the first time the host is seen. Nil is returned if the
+// host has none. As with probes, they are dropped once Forget is called for the URL's host name or the owner's
+func (sc *SiteFileCache) Get(owner string, u string, conf *config.Config) *matcher.SiteFiles {
+	key := HostKeyFromString(u)
+
+	sc.mu.Lock()
+	entry, ok := sc.hosts[key]
+	if !ok {
+		entry = &siteFilesEntry{}
+		sc.hosts[key] = entry
+	}
+	sc.names.add(key, owner, HostName(u))
+	sc.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.files = fetchSiteFiles(u, conf)
+	})
+	return entry.files
+}
+
+// Forget drops the site files cached for a host name, once no more tasks for the host will run
+func (sc *SiteFileCache) Forget(host string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	for _, key := range sc.names.forget(host) {
+		delete(sc.hosts, key)
+	}
+}
+
+func fetchSiteFiles(u string, conf *config.Config) *matcher.SiteFiles {
+	files := matcher.NewSiteFiles()
+	found := map[string]bool{}
+
+	for _, siteFile := range siteFilePaths {
+		if found[siteFile.file] {
+			continue
+		}
+
+		fileUrl := ResolveUrl(u, siteFile.path)
+		content, err := FetchResource(fileUrl, conf, maxSiteFileSize)
+		if err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error fetching %v: %v\n", fileUrl, err)
+			}
+			continue
+		}
+
+		// Missing files are often answered with an HTML page rather than a 404
+		if len(content) == 0 || strings.HasPrefix(http.DetectContentType(content), "text/html") {
+			continue
+		}
+		found[siteFile.file] = true
+		files.Add(siteFile.file, string(content))
+	}
+
+	if !files.Found() {
+		return nil
+	}
+	return files
+}
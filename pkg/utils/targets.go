@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+// Largest CIDR range that will be expanded into individual hosts
+const maxCidrHosts = 65536
+
+type Target struct {
+	// The value provided as input, before being expanded into URLs
+	Input string
+	// Candidate URLs to try in order. The first one to answer is scanned
+	Candidates []string
+	// Additional data about the target (i.e. from a port scan) to include in results
+	Metadata map[string]interface{}
+}
+
+// parseTargets converts a line of input into targets. URLs are used as is, while hosts, host:port pairs, IPs and CIDR
+// ranges are expanded into a target per port, with a candidate URL for each scheme configured
+func parseTargets(input string, conf *config.Config) ([]Target, error) {
+	if strings.Contains(input, "://") {
+		u, err := url.Parse(input)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.New(fmt.Sprintf("%v is not an absolute URL", input))
+		}
+		return []Target{{Input: input, Candidates: []string{u.String()}}}, nil
+	}
+
+	if _, network, err := net.ParseCIDR(input); err == nil {
+		ips, err := expandCidr(network)
+		if err != nil {
+			return nil, err
+		}
+
+		var targets []Target
+		for _, ip := range ips {
+			targets = append(targets, hostTargets(input, ip.String(), "", targetPorts("", conf), conf.Schemes)...)
+		}
+		return targets, nil
+	}
+
+	hostPort, path := input, ""
+	if i := strings.Index(input, "/"); i != -1 {
+		hostPort, path = input[:i], input[i:]
+	}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// No port provided, which includes bare IPv6 addresses
+		host, port = strings.Trim(hostPort, "[]"), ""
+	}
+
+	if !isValidHost(host) {
+		return nil, errors.New(fmt.Sprintf("%v is not a valid URL, host or IP address", input))
+	}
+	if p, err := strconv.Atoi(port); port != "" && (err != nil || p < 1 || p > 65535) {
+		return nil, errors.New(fmt.Sprintf("%v is not a valid port in %v", port, input))
+	}
+	return hostTargets(input, host, path, targetPorts(port, conf), conf.Schemes), nil
+}
+
+// targetPorts returns the ports to scan for a host, the one provided in the input or those configured. An empty
+// port means the default port of each scheme is used
+func targetPorts(port string, conf *config.Config) []string {
+	if port != "" {
+		return []string{port}
+	}
+	if len(conf.Ports) == 0 {
+		return []string{""}
+	}
+	return conf.Ports
+}
+
+func hostTargets(input string, host string, path string, ports []string, schemes []string) []Target {
+	var targets []Target
+	for _, p := range ports {
+		target := Target{Input: input}
+		for _, scheme := range schemes {
+			hostPort := host
+			if strings.Contains(host, ":") {
+				hostPort = "[" + host + "]"
+			}
+			if p != "" && p != defaultPorts[scheme] {
+				hostPort = net.JoinHostPort(host, p)
+			}
+
+			u := url.URL{Scheme: scheme, Host: hostPort, Path: path}
+			if path == "" {
+				u.Path = "/"
+			}
+			target.Candidates = append(target.Candidates, u.String())
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func expandCidr(network *net.IPNet) ([]net.IP, error) {
+	ones, bits := network.Mask.Size()
+	if bits-ones > 31 || 1<<uint(bits-ones) > maxCidrHosts {
+		return nil, errors.New(fmt.Sprintf("%v is too large to expand (max %v hosts)", network, maxCidrHosts))
+	}
+
+	var ips []net.IP
+	count := 1 << uint(bits-ones)
+	for i := 0; i < count; i++ {
+		ip := make(net.IP, len(network.IP))
+		copy(ip, network.IP)
+
+		// Add the offset to the last 4 bytes of the network address
+		offset := len(ip) - 4
+		binary.BigEndian.PutUint32(ip[offset:], binary.BigEndian.Uint32(ip[offset:])+uint32(i))
+
+		// Skip the network and broadcast addresses of IPv4 ranges that have them
+		if ip.To4() != nil && count > 2 && (i == 0 || i == count-1) {
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+func isValidHost(host string) bool {
+	if host == "" {
+		return false
+	}
+
+	if net.ParseIP(host) != nil {
+		return true
+	}
+
+	for _, r := range host {
+		if r == '.' || r == '-' || r == '_' || r > 127 ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ameenmaali/whoareyou/pkg/config"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		targets int
+		want    []string
+		err     bool
+	}{
+		{name: "url", input: "https://example.com/a", targets: 1, want: []string{"https://example.com/a"}},
+		{name: "host", input: "example.com", targets: 1, want: []string{"https://example.com/", "http://example.com/"}},
+		{name: "host and port", input: "example.com:8080/app", targets: 1, want: []string{"https://example.com:8080/app", "http://example.com:8080/app"}},
+		{name: "ipv6 and port", input: "[2001:db8::1]:443", targets: 1, want: []string{"https://[2001:db8::1]/", "http://[2001:db8::1]:443/"}},
+		{name: "port not a number", input: "example.com:abc", err: true},
+		{name: "port zero", input: "example.com:0", err: true},
+		{name: "port out of range", input: "example.com:65536", err: true},
+		{name: "cidr", input: "10.0.0.0/30", targets: 2, want: []string{"https://10.0.0.1/", "http://10.0.0.1/"}},
+		// The network and broadcast addresses are skipped
+		{name: "largest cidr", input: "10.0.0.0/16", targets: maxCidrHosts - 2},
+		{name: "cidr too large", input: "10.0.0.0/15", err: true},
+		{name: "ipv6 cidr too large", input: "2001:db8::/64", err: true},
+	}
+
+	conf := &config.Config{Schemes: []string{"https", "http"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := parseTargets(tt.input, conf)
+			if (err != nil) != tt.err {
+				t.Fatalf("parseTargets(%v) error = %v, want error: %v", tt.input, err, tt.err)
+			}
+			if len(targets) != tt.targets {
+				t.Fatalf("parseTargets(%v) returned %v targets, want %v", tt.input, len(targets), tt.targets)
+			}
+			if tt.want != nil && !reflect.DeepEqual(targets[0].Candidates, tt.want) {
+				t.Errorf("candidates = %v, want %v", targets[0].Candidates, tt.want)
+			}
+		})
+	}
+}
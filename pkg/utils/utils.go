@@ -1,43 +1,11 @@
 package utils
 
 import (
-	"bufio"
 	"errors"
-	"github.com/ameenmaali/whoareyou/pkg/config"
-	"net/url"
-	"os"
 	"regexp"
 	"strings"
 )
 
-func GetUrlsFromFile(conf *config.Config) ([]string, error) {
-	deduplicatedUrls := make(map[string]bool)
-	var urls []string
-
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		providedUrl := scanner.Text()
-
-		// Only include properly formatted URLs
-		u, err := url.ParseRequestURI(providedUrl)
-		if err != nil {
-			if conf.DebugMode {
-				conf.Utils.PrintRed(os.Stderr, "url provided [%v] is not a properly formatted URL\n", providedUrl)
-			}
-			continue
-		}
-
-		if deduplicatedUrls[u.String()] {
-			continue
-		}
-
-		deduplicatedUrls[u.String()] = true
-		urls = append(urls, u.String())
-	}
-
-	return urls, scanner.Err()
-}
-
 func stringToRegex(value interface{}) (*regexp.Regexp, error) {
 	str, err := cleanString(value)
 	if err != nil {
@@ -82,7 +50,7 @@ func mapToRegexMap(value interface{}) (map[string]*regexp.Regexp, error) {
 
 	regexMap := map[string]*regexp.Regexp{}
 	for key, val := range values {
-		re, err := regexp.Compile(val.(string))
+		re, err := stringToRegex(val)
 		if err != nil {
 			continue
 		}
@@ -3,105 +3,357 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ameenmaali/whoareyou/pkg/config"
 	"github.com/ameenmaali/whoareyou/pkg/matcher"
 )
 
-const WAPPALYZER_SOURCE_URL = "https://raw.githubusercontent.com/AliasIO/wappalyzer/master/src/apps.json"
+// Default source of the Wappalyzer dataset, in the format Wappalyzer has published it in since 2021: technologies split
+// into a file per first letter (technologies/a.json to z.json, and _.json for other names), and their categories in
+// categories.json. Wappalyzer no longer publishes it, so this is a maintained fork
+const WAPPALYZER_SOURCE_URL = "https://raw.githubusercontent.com/enthec/webappanalyzer/main/src/"
 
+// Names of the technology files of the dataset, one per first letter, and _ for names starting with anything else
+var wappalyzerTechnologyFiles = strings.Split("_abcdefghijklmnopqrstuvwxyz", "")
+
+// wappalyzerDataset is the technologies of the dataset by name, and the names of their categories by ID
+type wappalyzerDataset struct {
+	technologies map[string]map[string]interface{}
+	categories   map[string]string
+}
+
+// FetchWappalyzerData loads the Wappalyzer dataset from the source configured with -wappalyzer-data, or the default
+// source. A source can be the URL or directory of a dataset in the current format (with technologies/ and
+// categories.json), the URL or path of a single JSON file of technologies, or a legacy apps.json
 func FetchWappalyzerData(conf *config.Config) (map[string]matcher.AppMatch, error) {
 	wappalyzerData := map[string]matcher.AppMatch{}
-	resp, err := SendRequest(WAPPALYZER_SOURCE_URL, conf)
-	if err != nil {
+
+	source := conf.WappalyzerData
+	if source == "" {
+		source = WAPPALYZER_SOURCE_URL
+	}
+
+	dataset := &wappalyzerDataset{
+		technologies: make(map[string]map[string]interface{}),
+		categories:   make(map[string]string),
+	}
+	if err := dataset.load(source, conf); err != nil {
 		return wappalyzerData, err
 	}
 
-	responseBody := make(map[string]map[string]map[string]interface{})
+	for app, fields := range dataset.technologies {
+		wappalyzerData[strings.ToLower(app)] = parseWappalyzerApp(app, fields, dataset.categories, conf)
+	}
+	return wappalyzerData, nil
+}
 
-	err = json.Unmarshal(resp.Body, &responseBody)
+// load adds the technologies and categories of a dataset's URL or directory, or of a single file
+func (wd *wappalyzerDataset) load(source string, conf *config.Config) error {
+	isUrl := strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+	if isUrl {
+		if strings.HasSuffix(strings.ToLower(source), ".json") {
+			return wd.loadFile(source, conf)
+		}
 
-	for _, value := range responseBody {
-		for app, apps := range value {
-			match := matcher.Matcher{
-				Cookies:         nil,
-				Icon:            "",
-				Headers:         nil,
-				ResponseContent: nil,
-				Script:          nil,
-				JavaScript:      nil,
-				Meta:            nil,
+		base := strings.TrimSuffix(source, "/") + "/"
+		for _, name := range wappalyzerTechnologyFiles {
+			if err := wd.loadFile(base+"technologies/"+name+".json", conf); err != nil {
+				return err
 			}
+		}
+		return wd.loadFile(base+"categories.json", conf)
+	}
 
-			wapp := matcher.AppMatch{
-				Name:    app,
-				Website: "",
-				Matches: &match,
-			}
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return wd.loadFile(source, conf)
+	}
+
+	// Technology files are in technologies/, or alongside categories.json
+	dir := source
+	if info, err := os.Stat(filepath.Join(source, "technologies")); err == nil && info.IsDir() {
+		dir = filepath.Join(source, "technologies")
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if categories := filepath.Join(source, "categories.json"); fileExists(categories) && !containsPath(paths, categories) {
+		paths = append(paths, categories)
+	}
+	sort.Strings(paths)
+
+	for _, file := range paths {
+		if err := wd.loadFile(file, conf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadFile adds the technologies or categories (if named categories.json) of a file, given as a URL or path
+func (wd *wappalyzerDataset) loadFile(source string, conf *config.Config) error {
+	data, err := readWappalyzerFile(source, conf)
+	if err != nil {
+		return err
+	}
 
-			if apps["website"] != nil {
-				wapp.Website = apps["website"].(string)
+	if filepath.Base(source) == "categories.json" {
+		return wd.addCategories(data, source)
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return errors.New(fmt.Sprintf("error parsing %v: %v", source, err))
+	}
+
+	// The legacy apps.json holds both technologies (under apps) and categories
+	if apps, ok := document["apps"]; ok {
+		data = apps
+		if categories, ok := document["categories"]; ok {
+			if err := wd.addCategories(categories, source); err != nil {
+				return err
 			}
+		}
+	}
 
-			if apps["icon"] != nil {
-				match.Icon = apps["icon"].(string)
+	var technologies map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &technologies); err != nil {
+		return errors.New(fmt.Sprintf("error parsing %v: %v", source, err))
+	}
+	for name, fields := range technologies {
+		wd.technologies[name] = fields
+	}
+	return nil
+}
+
+// addCategories adds the categories of a file, which map IDs to a category object, or to a name in older versions
+func (wd *wappalyzerDataset) addCategories(data []byte, source string) error {
+	var categories map[string]interface{}
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return errors.New(fmt.Sprintf("error parsing %v: %v", source, err))
+	}
+
+	for id, value := range categories {
+		switch category := value.(type) {
+		case string:
+			wd.categories[id] = category
+		case map[string]interface{}:
+			if name, ok := category["name"].(string); ok {
+				wd.categories[id] = name
 			}
+		}
+	}
+	return nil
+}
+
+func readWappalyzerFile(source string, conf *config.Config) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+
+	resp, err := SendRequest(source, conf)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("%v returned status %v", source, resp.StatusCode))
+	}
+	return resp.Body, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func containsPath(paths []string, file string) bool {
+	for _, p := range paths {
+		if p == file {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWappalyzerApp parses the fingerprints of a technology, along with its description, website and categories
+func parseWappalyzerApp(app string, apps map[string]interface{}, categories map[string]string, conf *config.Config) matcher.AppMatch {
+	match := matcher.Matcher{
+		Cookies:         nil,
+		Icon:            "",
+		Headers:         nil,
+		ResponseContent: nil,
+		Script:          nil,
+		JavaScript:      nil,
+		Meta:            nil,
+	}
+
+	wapp := matcher.AppMatch{
+		Name:    app,
+		Website: "",
+		Matches: &match,
+	}
 
-			if apps["html"] != nil {
-				if err := stringOrSliceHandler(apps["html"], &match.ResponseContent); err != nil {
-					if conf.DebugMode {
-						conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer html data", err)
-					}
+	if website, ok := apps["website"].(string); ok {
+		wapp.Website = website
+	}
+
+	if description, ok := apps["description"].(string); ok {
+		wapp.Description = description
+	}
+
+	if cats, ok := apps["cats"].([]interface{}); ok {
+		for _, cat := range cats {
+			if id, ok := cat.(float64); ok {
+				if name, ok := categories[strconv.Itoa(int(id))]; ok {
+					wapp.Categories = append(wapp.Categories, name)
 				}
 			}
+		}
+	}
 
-			if apps["headers"] != nil {
-				if err := mapHandler(apps["headers"], &match.Headers); err != nil {
-					if conf.DebugMode {
-						conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer header data", err)
-					}
-				}
+	if icon, ok := apps["icon"].(string); ok {
+		match.Icon = icon
+	}
+
+	if apps["html"] != nil {
+		if err := stringOrSliceHandler(apps["html"], &match.ResponseContent); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer html data: %v\n", err)
 			}
+		}
+	}
 
-			if apps["cookies"] != nil {
-				if err := mapHandler(apps["cookies"], &match.Cookies); err != nil {
-					if conf.DebugMode {
-						conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer cookie data", err)
-					}
-				}
+	if apps["url"] != nil {
+		if err := stringOrSliceHandler(apps["url"], &match.Url); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer url data: %v\n", err)
 			}
+		}
+	}
 
-			if apps["script"] != nil {
-				if err := stringOrSliceHandler(apps["script"], &match.Script); err != nil {
-					if conf.DebugMode {
-						conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer script data", err)
-					}
-				}
+	if apps["certIssuer"] != nil {
+		if err := stringOrSliceHandler(apps["certIssuer"], &match.CertIssuer); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer certIssuer data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["dns"] != nil {
+		if err := dnsHandler(apps["dns"], &match.Dns); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer dns data: %v\n", err)
 			}
+		}
+	}
 
-			if apps["js"] != nil {
-				if err := mapHandler(apps["js"], &match.JavaScript); err != nil {
-					if conf.DebugMode {
-						conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer js data", err)
-					}
-				}
+	if apps["robots"] != nil {
+		var robots []*regexp.Regexp
+		if err := stringOrSliceHandler(apps["robots"], &robots); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer robots data: %v\n", err)
 			}
+		}
+		match.SiteFiles = map[string][]*regexp.Regexp{matcher.RobotsFile: robots}
+	}
 
-			if apps["meta"] != nil {
-				if err := mapHandler(apps["meta"], &match.Meta); err != nil {
-					if conf.DebugMode {
-						conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer meta data", err)
-					}
-				}
+	if apps["text"] != nil {
+		if err := stringOrSliceHandler(apps["text"], &match.Text); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer text data: %v\n", err)
 			}
-			wappalyzerData[strings.ToLower(wapp.Name)] = wapp
 		}
 	}
 
-	return wappalyzerData, nil
+	if apps["headers"] != nil {
+		if err := mapHandler(apps["headers"], &match.Headers); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer header data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["cookies"] != nil {
+		if err := mapHandler(apps["cookies"], &match.Cookies); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer cookie data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["script"] != nil {
+		if err := stringOrSliceHandler(apps["script"], &match.Script); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer script data: %v\n", err)
+			}
+		}
+	}
+
+	// Newer versions of the dataset name script src patterns scriptSrc, and use scripts for script content
+	if apps["scriptSrc"] != nil {
+		if err := stringOrSliceHandler(apps["scriptSrc"], &match.Script); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer scriptSrc data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["scripts"] != nil {
+		if err := stringOrSliceHandler(apps["scripts"], &match.ScriptContent); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer scripts data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["css"] != nil {
+		if err := stringOrSliceHandler(apps["css"], &match.Css); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer css data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["dom"] != nil {
+		// Rules checking JavaScript properties, and invalid selectors, are skipped without dropping the other rules
+		domRules, errs := matcher.ParseWappalyzerDomRules(apps["dom"])
+		if conf.DebugMode {
+			for _, err := range errs {
+				conf.Utils.PrintRed(os.Stderr, "skipping wappalyzer dom rule of %v: %v\n", app, err)
+			}
+		}
+		match.Dom = domRules
+	}
+
+	if apps["js"] != nil {
+		if err := mapHandler(apps["js"], &match.JavaScript); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer js data: %v\n", err)
+			}
+		}
+	}
+
+	if apps["meta"] != nil {
+		if err := mapHandler(apps["meta"], &match.Meta); err != nil {
+			if conf.DebugMode {
+				conf.Utils.PrintRed(os.Stderr, "error parsing wappalyzer meta data: %v\n", err)
+			}
+		}
+	}
+	return wapp
 }
 
 func stringOrSliceHandler(value interface{}, matchResult *[]*regexp.Regexp) error {
@@ -127,8 +379,27 @@ func stringOrSliceHandler(value interface{}, matchResult *[]*regexp.Regexp) erro
 	if errorCount >= 2 {
 		return errors.New(matchError)
 	} else {
-		*matchResult = append(matches)
+		*matchResult = matches
+	}
+	return nil
+}
+
+// dnsHandler parses DNS rules, which map record types to a regex value or list of regex values
+func dnsHandler(value interface{}, matchResult *map[string][]*regexp.Regexp) error {
+	records, ok := value.(map[string]interface{})
+	if !ok {
+		return errors.New("value provided is not a properly formated map")
+	}
+
+	dnsMap := map[string][]*regexp.Regexp{}
+	for recordType, val := range records {
+		var matches []*regexp.Regexp
+		if err := stringOrSliceHandler(val, &matches); err != nil {
+			continue
+		}
+		dnsMap[strings.ToUpper(recordType)] = matches
 	}
+	*matchResult = dnsMap
 	return nil
 }
 
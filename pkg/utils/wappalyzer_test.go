@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ameenmaali/whoareyou/pkg/config"
+	"github.com/ameenmaali/whoareyou/pkg/matcher"
+)
+
+// Dataset in the current format, with a few technologies from the published dataset
+var wappalyzerFixture = filepath.Join("testdata", "wappalyzer")
+
+func TestFetchWappalyzerData(t *testing.T) {
+	// Letters without technologies in the fixture are served empty, as the published dataset has every letter
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadFile(filepath.Join(wappalyzerFixture, filepath.FromSlash(r.URL.Path)))
+		if err != nil && strings.HasPrefix(r.URL.Path, "/technologies/") {
+			data, err = []byte("{}"), nil
+		}
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "wappalyzer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	legacy := filepath.Join(dir, "apps.json")
+	content := `{"apps": {"Acme": {"cats": [1], "html": "acme"}}, "categories": {"1": "CMS"}}`
+	if err := ioutil.WriteFile(legacy, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	all := []string{"1C-Bitrix", "Bootstrap", "Cloudflare", "Heroku", "Let's Encrypt", "Shopify", "Vue.js"}
+	allCategories := map[string][]string{
+		"1C-Bitrix":     {"CMS"},
+		"Bootstrap":     {"UI frameworks"},
+		"Cloudflare":    {"CDN"},
+		"Heroku":        {"PaaS"},
+		"Let's Encrypt": {"SSL/TLS certificate authorities"},
+		"Shopify":       {"CMS"},
+		"Vue.js":        {"JavaScript frameworks"},
+	}
+
+	tests := []struct {
+		name         string
+		source       string
+		technologies []string
+		categories   map[string][]string
+		err          bool
+	}{
+		{name: "directory", source: wappalyzerFixture, technologies: all, categories: allCategories},
+		{name: "url", source: server.URL + "/", technologies: all, categories: allCategories},
+		{name: "url without trailing slash", source: server.URL, technologies: all, categories: allCategories},
+		{
+			// Categories aren't known without categories.json
+			name:         "technologies file",
+			source:       filepath.Join(wappalyzerFixture, "technologies", "v.json"),
+			technologies: []string{"Vue.js"},
+			categories:   map[string][]string{"Vue.js": nil},
+		},
+		{
+			name:         "technologies file url",
+			source:       server.URL + "/technologies/v.json",
+			technologies: []string{"Vue.js"},
+			categories:   map[string][]string{"Vue.js": nil},
+		},
+		{name: "legacy apps.json", source: legacy, technologies: []string{"Acme"}, categories: map[string][]string{"Acme": {"CMS"}}},
+		{name: "missing directory", source: filepath.Join(dir, "missing"), err: true},
+		{name: "missing url", source: server.URL + "/missing/", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &config.Config{HttpClient: server.Client(), WappalyzerData: tt.source}
+			data, err := FetchWappalyzerData(conf)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("FetchWappalyzerData() loaded %v technologies, want an error", len(data))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for key, app := range data {
+				if key != strings.ToLower(app.Name) {
+					t.Errorf("technology %v loaded as %v", app.Name, key)
+				}
+				names = append(names, app.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.technologies) {
+				t.Fatalf("technologies = %v, want %v", names, tt.technologies)
+			}
+
+			for name, categories := range tt.categories {
+				if got := data[strings.ToLower(name)].Categories; !reflect.DeepEqual(got, categories) {
+					t.Errorf("categories of %v = %v, want %v", name, got, categories)
+				}
+			}
+		})
+	}
+}
+
+func TestParseWappalyzerApp(t *testing.T) {
+	data, err := FetchWappalyzerData(&config.Config{WappalyzerData: wappalyzerFixture})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		technology string
+		// Whether the fields of the technology were parsed
+		parsed func(app matcher.AppMatch) bool
+	}{
+		{technology: "1C-Bitrix", parsed: func(app matcher.AppMatch) bool {
+			return len(app.Matches.Cookies) == 2 && len(app.Matches.Headers) == 2 && len(app.Matches.Script) == 1
+		}},
+		{technology: "Bootstrap", parsed: func(app matcher.AppMatch) bool {
+			return len(app.Matches.Css) == 1 && app.Matches.Css[0].MatchString("--bs-primary: #0d6efd")
+		}},
+		{technology: "Cloudflare", parsed: func(app matcher.AppMatch) bool {
+			return len(app.Matches.Dns["NS"]) == 1 && app.Matches.Dns["NS"][0].MatchString("kate.ns.cloudflare.com")
+		}},
+		{technology: "Heroku", parsed: func(app matcher.AppMatch) bool {
+			return len(app.Matches.Text) == 1 && len(app.Matches.Url) == 1 && app.Website == "https://www.heroku.com/"
+		}},
+		{technology: "Let's Encrypt", parsed: func(app matcher.AppMatch) bool {
+			return len(app.Matches.CertIssuer) == 1 && app.Matches.CertIssuer[0].MatchString("Let's Encrypt")
+		}},
+		{technology: "Shopify", parsed: func(app matcher.AppMatch) bool {
+			robots := app.Matches.SiteFiles[matcher.RobotsFile]
+			return len(robots) == 1 && robots[0].MatchString("Disallow: /12345/checkouts")
+		}},
+		{technology: "Vue.js", parsed: func(app matcher.AppMatch) bool {
+			return len(app.Matches.Dom) == 1 && len(app.Matches.JavaScript) == 1 && app.Description != ""
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.technology, func(t *testing.T) {
+			app, ok := data[strings.ToLower(tt.technology)]
+			if !ok {
+				t.Fatalf("%v not loaded", tt.technology)
+			}
+			if !tt.parsed(app) {
+				t.Errorf("fields of %v not parsed: %+v", tt.technology, *app.Matches)
+			}
+		})
+	}
+}
+
+func TestWappalyzerDomRules(t *testing.T) {
+	// Vue.js has a dom rule checking for an element, and one checking a JavaScript property of div elements
+	data, err := FetchWappalyzerData(&config.Config{WappalyzerData: filepath.Join(wappalyzerFixture, "technologies", "v.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, ok := data["vue.js"]
+	if !ok {
+		t.Fatal("vue.js not loaded")
+	}
+
+	tests := []struct {
+		name    string
+		page    string
+		matches []string
+	}{
+		{name: "element found", page: `<html><body><div id="app" data-v-app=""></div></body></html>`, matches: []string{"dom"}},
+		// The properties rule is skipped, so a div alone doesn't match
+		{name: "properties rule skipped", page: `<html><body><div id="app"></div></body></html>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.page))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := &matcher.MatchResult{TechnologyMatches: map[string][]string{}}
+			app.Matches.Evaluate("vue.js", &matcher.ResponseData{Document: doc}, result)
+			if got := result.TechnologyMatches["vue.js"]; !reflect.DeepEqual(got, tt.matches) {
+				t.Errorf("matches = %v, want %v", got, tt.matches)
+			}
+		})
+	}
+}